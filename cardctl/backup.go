@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/Bredgren/cards/carddb"
+)
+
+func backupDB(en *env, args []string) error {
+	pos, e := en.parse(en.flags(), args, 1)
+	if e != nil {
+		return e
+	}
+	if e := en.db.Backup(pos[0]); e != nil {
+		return e
+	}
+	return en.printf(map[string]string{"backup": pos[0]}, "Backed up %s to %s\n", en.dbFile, pos[0])
+}
+
+func restoreDB(en *env, args []string) error {
+	pos, e := en.parse(en.flags(), args, 1)
+	if e != nil {
+		return e
+	}
+	version, e := carddb.CheckBackup(pos[0])
+	if e != nil {
+		return e
+	}
+	// The database is replaced, not written through
+	if e := en.db.Close(); e != nil {
+		return e
+	}
+	old, e := carddb.Restore(pos[0], en.dbFile)
+	if e != nil {
+		return e
+	}
+	res := struct {
+		Backup  string
+		Version int
+		Old     string
+	}{pos[0], version, old}
+	if old == "" {
+		return en.printf(res, "Restored %s (schema version %d) to %s\n", pos[0], version, en.dbFile)
+	}
+	return en.printf(res, "Restored %s (schema version %d) to %s, the replaced database is %s\n",
+		pos[0], version, en.dbFile, old)
+}
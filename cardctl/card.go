@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// cardFlags adds flags for the settable fields of card to fs, using the current values as
+// the defaults, so that parsing fs updates card
+func cardFlags(fs *flag.FlagSet, card *carddb.Card) {
+	fs.StringVar(&card.Front, "front", card.Front, "Front of the card")
+	fs.StringVar(&card.Back, "back", card.Back, "Back of the card")
+	fs.IntVar(&card.Views, "views", card.Views, "View count")
+	fs.BoolVar(&card.Suspended, "suspended", card.Suspended, "Never pick the card for study")
+}
+
+// cardStatus describes the leech and suspended flags of a card for listing
+func cardStatus(c *carddb.Card) string {
+	var flags []string
+	if c.Leech {
+		flags = append(flags, "leech")
+	}
+	if c.Suspended {
+		flags = append(flags, "suspended")
+	}
+	return strings.Join(flags, ",")
+}
+
+func listCards(en *env, args []string) error {
+	fs := en.flags()
+	deckID := fs.Int("deck", -1, "Only list cards in this deck, 0 for cards in no deck")
+	if _, e := en.parse(fs, args, 0); e != nil {
+		return e
+	}
+
+	if *deckID > 0 {
+		if _, e := en.getDeck(strconv.Itoa(*deckID)); e != nil {
+			return e
+		}
+	}
+	cards, e := en.db.GetCards(*deckID)
+	if e != nil {
+		return e
+	}
+	sort.Sort(carddb.CardsByID(cards))
+
+	rows := make([][]string, len(cards))
+	for i, c := range cards {
+		rows[i] = []string{strconv.Itoa(c.ID), c.Front, c.Back, strconv.Itoa(c.Views), lastViewed(c), cardStatus(c)}
+	}
+
+	return en.print(cards, []string{"ID", "FRONT", "BACK", "VIEWS", "LAST VIEW", "STATUS"}, rows)
+}
+
+func newCard(en *env, args []string) error {
+	card := &carddb.Card{}
+	fs := en.flags()
+	cardFlags(fs, card)
+	deckID := fs.Int("deck", 0, "Add the card to this deck")
+	if _, e := en.parse(fs, args, 0); e != nil {
+		return e
+	}
+
+	var deck *carddb.Deck
+	if *deckID != 0 {
+		var e error
+		if deck, e = en.getDeck(strconv.Itoa(*deckID)); e != nil {
+			return e
+		}
+	}
+
+	created, e := en.db.NewCard()
+	if e != nil {
+		return e
+	}
+	set := setFlags(fs)
+	if set["front"] {
+		created.Front = card.Front
+	}
+	created.Back = card.Back
+	created.Views = card.Views
+	created.Suspended = card.Suspended
+	if e := en.db.UpdateCard(created); e != nil {
+		return e
+	}
+
+	if deck != nil {
+		if e := en.db.AddCardToDeck(created.ID, deck.ID); e != nil {
+			return e
+		}
+	}
+
+	return en.printf(created, "Created card %d\n", created.ID)
+}
+
+func editCard(en *env, args []string) error {
+	card := &carddb.Card{}
+	fs := en.flags()
+	cardFlags(fs, card)
+	pos, e := en.parse(fs, args, 1)
+	if e != nil {
+		return e
+	}
+
+	current, e := en.getCard(pos[0])
+	if e != nil {
+		return e
+	}
+	set := setFlags(fs)
+	if set["front"] {
+		current.Front = card.Front
+	}
+	if set["back"] {
+		current.Back = card.Back
+	}
+	if set["views"] {
+		current.Views = card.Views
+	}
+	if set["suspended"] {
+		current.Suspended = card.Suspended
+		// The same as unsuspending on the web
+		if !card.Suspended {
+			current.Leech = false
+		}
+	}
+	if _, e := en.db.EditCard(current, author()); e != nil {
+		return e
+	}
+
+	return en.printf(current, "Updated card %d\n", current.ID)
+}
+
+func delCard(en *env, args []string) error {
+	pos, e := en.parse(en.flags(), args, 1)
+	if e != nil {
+		return e
+	}
+
+	card, e := en.getCard(pos[0])
+	if e != nil {
+		return e
+	}
+	if _, e := en.db.TrashCard(card.ID, author()); e != nil {
+		return e
+	}
+
+	return en.printf(card, "Moved card %d to the trash\n", card.ID)
+}
+
+// cardAndDeck parses the <card> <deck> arguments of add and remove
+func cardAndDeck(en *env, args []string) (*carddb.Card, *carddb.Deck, error) {
+	pos, e := en.parse(en.flags(), args, 2)
+	if e != nil {
+		return nil, nil, e
+	}
+	card, e := en.getCard(pos[0])
+	if e != nil {
+		return nil, nil, e
+	}
+	deck, e := en.getDeck(pos[1])
+	if e != nil {
+		return nil, nil, e
+	}
+	return card, deck, nil
+}
+
+// membership is the JSON output of add and remove
+type membership struct {
+	Card int
+	Deck int
+}
+
+func addToDeck(en *env, args []string) error {
+	card, deck, e := cardAndDeck(en, args)
+	if e != nil {
+		return e
+	}
+	if e := en.db.AddCardToDeck(card.ID, deck.ID); e != nil {
+		return e
+	}
+	return en.printf(membership{card.ID, deck.ID}, "Added card %d to deck '%s'\n", card.ID, deck.Name)
+}
+
+func removeFromDeck(en *env, args []string) error {
+	card, deck, e := cardAndDeck(en, args)
+	if e != nil {
+		return e
+	}
+	if e := en.db.DelCardFromDeck(card.ID, deck.ID); e != nil {
+		return e
+	}
+	return en.printf(membership{card.ID, deck.ID}, "Removed card %d from deck '%s'\n", card.ID, deck.Name)
+}
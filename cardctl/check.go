@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func checkDB(en *env, args []string) error {
+	fs := en.flags()
+	fix := fs.Bool("fix", false, "Fix the problems that can be fixed")
+	if _, e := en.parse(fs, args, 0); e != nil {
+		return e
+	}
+
+	problems, e := en.db.CheckIntegrity(*fix)
+	if e != nil {
+		return e
+	}
+	if len(problems) == 0 {
+		return en.printf(problems, "No problems found in %s\n", en.dbFile)
+	}
+
+	remaining := 0
+	var rows [][]string
+	for _, p := range problems {
+		fix := p.Fix
+		switch {
+		case p.Fixed:
+			fix = "fixed: " + fix
+		case fix == "":
+			fix = "can't fix"
+		}
+		if !p.Fixed {
+			remaining++
+		}
+		rowID := ""
+		if p.Table != "" {
+			rowID = strconv.FormatInt(p.RowID, 10)
+		}
+		rows = append(rows, []string{p.Kind, p.Table, rowID, p.Description, fix})
+	}
+	if e := en.print(problems, []string{"PROBLEM", "TABLE", "ROW", "DESCRIPTION", "FIX"}, rows); e != nil {
+		return e
+	}
+	// Unfixed problems fail the command so scripts notice them
+	switch {
+	case remaining == 0:
+		return nil
+	case !*fix:
+		return fmt.Errorf("found %d problems, run with -fix to fix them", remaining)
+	default:
+		return fmt.Errorf("%d of %d problems can't be fixed", remaining, len(problems))
+	}
+}
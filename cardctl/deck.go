@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// deckFlags adds flags for the settable fields of deck to fs, using the current values as
+// the defaults, so that parsing fs updates deck
+func deckFlags(fs *flag.FlagSet, deck *carddb.Deck) {
+	fs.StringVar(&deck.Name, "name", deck.Name, "Deck name")
+	fs.Float64Var(&deck.DateWeight, "date-weight", deck.DateWeight, "Weight of time since last view")
+	fs.Float64Var(&deck.ViewWeight, "view-weight", deck.ViewWeight, "Weight of view count")
+	fs.IntVar(&deck.ViewLimit, "view-limit", deck.ViewLimit, "Views after which the view count no longer matters")
+	fs.BoolVar(&deck.TypeAnswer, "type-answer", deck.TypeAnswer, "Ask for the back to be typed when studying")
+	fs.IntVar(&deck.LeechThreshold, "leech-threshold", deck.LeechThreshold, "Failures after which a card is a leech, 0 for never")
+	fs.BoolVar(&deck.LeechSuspend, "leech-suspend", deck.LeechSuspend, "Suspend cards when they become leeches")
+}
+
+// deckRow is a deck with its number of cards, for listing
+type deckRow struct {
+	*carddb.Deck
+	Cards int
+}
+
+func listDecks(en *env, args []string) error {
+	if _, e := en.parse(en.flags(), args, 0); e != nil {
+		return e
+	}
+
+	decks, e := en.sortedDecks()
+	if e != nil {
+		return e
+	}
+
+	list := make([]deckRow, len(decks))
+	rows := make([][]string, len(decks))
+	for i, deck := range decks {
+		cards, e := en.db.GetCards(deck.ID)
+		if e != nil {
+			return e
+		}
+		list[i] = deckRow{deck, len(cards)}
+		rows[i] = []string{
+			strconv.Itoa(deck.ID),
+			deck.Name,
+			strconv.Itoa(len(cards)),
+			formatFloat(deck.DateWeight),
+			formatFloat(deck.ViewWeight),
+			strconv.Itoa(deck.ViewLimit),
+		}
+	}
+
+	return en.print(list, []string{"ID", "NAME", "CARDS", "DATE WEIGHT", "VIEW WEIGHT", "VIEW LIMIT"}, rows)
+}
+
+func newDeck(en *env, args []string) error {
+	// The defaults match the schema's
+	deck := &carddb.Deck{DateWeight: 1, ViewWeight: 1, ViewLimit: 1, LeechThreshold: carddb.DefaultLeechThreshold}
+	fs := en.flags()
+	deckFlags(fs, deck)
+	pos, e := en.parse(fs, args, 1)
+	if e != nil {
+		return e
+	}
+
+	created, e := en.db.NewDeck(pos[0])
+	if e != nil {
+		return e
+	}
+	created.DateWeight = deck.DateWeight
+	created.ViewWeight = deck.ViewWeight
+	created.ViewLimit = deck.ViewLimit
+	created.TypeAnswer = deck.TypeAnswer
+	created.LeechThreshold = deck.LeechThreshold
+	created.LeechSuspend = deck.LeechSuspend
+	if e := en.db.UpdateDeck(created); e != nil {
+		return e
+	}
+
+	return en.printf(created, "Created deck %d '%s'\n", created.ID, created.Name)
+}
+
+func editDeck(en *env, args []string) error {
+	deck := &carddb.Deck{}
+	fs := en.flags()
+	deckFlags(fs, deck)
+	pos, e := en.parse(fs, args, 1)
+	if e != nil {
+		return e
+	}
+
+	current, e := en.getDeck(pos[0])
+	if e != nil {
+		return e
+	}
+	set := setFlags(fs)
+	if set["name"] {
+		current.Name = deck.Name
+	}
+	if set["date-weight"] {
+		current.DateWeight = deck.DateWeight
+	}
+	if set["view-weight"] {
+		current.ViewWeight = deck.ViewWeight
+	}
+	if set["view-limit"] {
+		current.ViewLimit = deck.ViewLimit
+	}
+	if set["type-answer"] {
+		current.TypeAnswer = deck.TypeAnswer
+	}
+	if set["leech-threshold"] {
+		current.LeechThreshold = deck.LeechThreshold
+	}
+	if set["leech-suspend"] {
+		current.LeechSuspend = deck.LeechSuspend
+	}
+	if _, e := en.db.EditDeck(current, author()); e != nil {
+		return e
+	}
+
+	return en.printf(current, "Updated deck %d '%s'\n", current.ID, current.Name)
+}
+
+func delDeck(en *env, args []string) error {
+	pos, e := en.parse(en.flags(), args, 1)
+	if e != nil {
+		return e
+	}
+
+	deck, e := en.getDeck(pos[0])
+	if e != nil {
+		return e
+	}
+	if _, e := en.db.TrashDeck(deck.ID, author()); e != nil {
+		return e
+	}
+
+	return en.printf(deck, "Moved deck %d '%s' to the trash\n", deck.ID, deck.Name)
+}
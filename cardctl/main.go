@@ -0,0 +1,272 @@
+// Command cardctl manages the decks and cards in a card database file directly, without
+// going through cardserver.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+const usage = `Usage: cardctl [-db file] [-json] <command> [arguments]
+
+Decks:
+  decks                          List all decks
+  deck new [flags] <name>        Create a deck
+  deck edit [flags] <deck>       Change a deck's name or weights
+  deck rm <deck>                 Move a deck to the trash, leaving its cards
+
+Cards:
+  cards [-deck id]               List cards, in a deck if given (0 for cards in no deck)
+  card new [flags]               Create a card
+  card edit [flags] <card>       Change a card's front, back or views
+  card rm <card>                 Move a card to the trash
+  add <card> <deck>              Add a card to a deck
+  remove <card> <deck>           Remove a card from a deck
+
+Trash:
+  trash list                     List the decks and cards in the trash
+  trash restore deck|card <id>   Take a deck or card out of the trash
+  trash purge deck|card <id>     Permanently delete a deck or card in the trash
+  trash empty [-older-than d]    Permanently delete everything in the trash
+
+Other:
+  export [-o file]               Write all decks and cards as JSON
+  import <file>                  Add the decks and cards from an export
+  stats [-deck id]               Show study statistics
+  study <deck>                   Study a deck in the terminal
+  backup <file>                  Copy the database to a new file, safe while in use
+  restore <file>                 Replace the database with a backup; stop cardserver first
+  check [-fix]                   Find and fix dangling rows, invalid weights and bad card stats
+
+Run 'cardctl <command> -h' for the flags of a command.
+`
+
+// errUsage is returned for bad command lines; the usage text is printed for it
+var errUsage = errors.New("invalid usage")
+
+// env is the state shared by all commands
+type env struct {
+	db      *carddb.Database
+	out     io.Writer
+	json    bool
+	dbFile  string
+	command string
+}
+
+// commands maps a command name to its implementation. Commands with subcommands, like
+// "deck new", are looked up with both words.
+var commands = map[string]func(e *env, args []string) error{
+	"decks":     listDecks,
+	"deck new":  newDeck,
+	"deck edit": editDeck,
+	"deck rm":   delDeck,
+	"cards":     listCards,
+	"card new":  newCard,
+	"card edit": editCard,
+	"card rm":   delCard,
+	"add":       addToDeck,
+	"remove":    removeFromDeck,
+	"export":    exportCards,
+	"import":    importCards,
+	"stats":     showStats,
+	"study":     study,
+	"backup":    backupDB,
+	"restore":   restoreDB,
+	"check":     checkDB,
+
+	"trash list":    listTrash,
+	"trash restore": restoreTrash,
+	"trash purge":   purgeTrash,
+	"trash empty":   emptyTrash,
+}
+
+func main() {
+	e := run(os.Args[1:], os.Stdout)
+	if e == errUsage {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if e == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if e != nil {
+		fmt.Fprintln(os.Stderr, "cardctl:", e)
+		os.Exit(1)
+	}
+}
+
+// run executes the command line args, writing output to out
+func run(args []string, out io.Writer) error {
+	en := &env{out: out}
+
+	fs := flag.NewFlagSet("cardctl", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	fs.StringVar(&en.dbFile, "db", "cards.db", "SQL card database file")
+	fs.BoolVar(&en.json, "json", false, "Output JSON instead of tables")
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	cmd, ok := commands[args[0]]
+	en.command, args = args[0], args[1:]
+	if !ok && len(args) > 0 {
+		cmd, ok = commands[en.command+" "+args[0]]
+		en.command, args = en.command+" "+args[0], args[1:]
+	}
+	if !ok {
+		return errUsage
+	}
+
+	// The command opens the database when it parses its arguments
+	defer func() {
+		if en.db != nil {
+			en.db.Close()
+		}
+	}()
+	return cmd(en, args)
+}
+
+// flags returns a FlagSet for the current command. -json is accepted by every command.
+func (en *env) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet(en.command, flag.ContinueOnError)
+	fs.BoolVar(&en.json, "json", en.json, "Output JSON instead of tables")
+	return fs
+}
+
+// parse parses args with fs, allowing flags before and after the positional arguments.
+// It fails unless there are exactly n positional arguments. Then it opens the database, so
+// bad arguments and -h don't create or migrate it.
+func (en *env) parse(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	var positional []string
+	for {
+		if e := fs.Parse(args); e != nil {
+			return nil, e
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) != n {
+		return nil, fmt.Errorf("%s: expected %d arguments, got %d", fs.Name(), n, len(positional))
+	}
+
+	var e error
+	en.db, e = carddb.OpenDatabase(en.dbFile)
+	return positional, e
+}
+
+// setFlags returns the names of the flags that were given on the command line
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// author identifies who is running cardctl in the revision history
+func author() string {
+	if u, e := user.Current(); e == nil {
+		return u.Username + " (cardctl)"
+	}
+	return "cardctl"
+}
+
+// atoi parses an ID argument
+func atoi(what, s string) (int, error) {
+	id, e := strconv.Atoi(s)
+	if e != nil {
+		return 0, fmt.Errorf("invalid %s ID %q", what, s)
+	}
+	return id, nil
+}
+
+// getDeck looks up a deck by the ID in s
+func (en *env) getDeck(s string) (*carddb.Deck, error) {
+	id, e := atoi("deck", s)
+	if e != nil {
+		return nil, e
+	}
+	deck := en.db.GetDeck(id)
+	if deck == nil {
+		return nil, fmt.Errorf("no deck with ID %d", id)
+	}
+	return deck, nil
+}
+
+// getCard looks up a card by the ID in s
+func (en *env) getCard(s string) (*carddb.Card, error) {
+	id, e := atoi("card", s)
+	if e != nil {
+		return nil, e
+	}
+	card := en.db.GetCard(id)
+	if card == nil {
+		return nil, fmt.Errorf("no card with ID %d", id)
+	}
+	return card, nil
+}
+
+// print writes v as JSON in JSON mode, otherwise it writes a table with the given header
+// and rows
+func (en *env) print(v interface{}, header []string, rows [][]string) error {
+	if en.json {
+		enc := json.NewEncoder(en.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	tw := tabwriter.NewWriter(en.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// printf writes a message in table mode. In JSON mode v is written instead.
+func (en *env) printf(v interface{}, format string, args ...interface{}) error {
+	if en.json {
+		return en.print(v, nil, nil)
+	}
+	_, e := fmt.Fprintf(en.out, format, args...)
+	return e
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// lastViewed formats the last view time of c for tables
+func lastViewed(c *carddb.Card) string {
+	if c.LastView.Year() <= 1 {
+		return "never"
+	}
+	return c.LastView.Format("2006-01-02 15:04")
+}
+
+// sortedDecks returns all decks sorted by name
+func (en *env) sortedDecks() ([]*carddb.Deck, error) {
+	decks, e := en.db.GetDecks(-1)
+	if e != nil {
+		return nil, e
+	}
+	sort.Sort(carddb.DecksByName(decks))
+	return decks, nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// cardctl runs the command line args against dbFile and returns the output
+func cardctl(t *testing.T, dbFile string, args ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	if e := run(append([]string{"-db", dbFile}, args...), &out); e != nil {
+		t.Fatalf("cardctl %v: %v", args, e)
+	}
+	return out.String()
+}
+
+func TestDecksAndCards(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "cards.db")
+
+	cardctl(t, dbFile, "deck", "new", "Spanish", "-view-limit", "5")
+	cardctl(t, dbFile, "card", "new", "-front", "hola", "-back", "hello", "-deck", "1")
+	cardctl(t, dbFile, "card", "new", "-front", "adios", "-back", "bye")
+	cardctl(t, dbFile, "add", "2", "1")
+	cardctl(t, dbFile, "card", "edit", "2", "-back", "goodbye", "-suspended")
+
+	var decks []deckRow
+	if e := json.Unmarshal([]byte(cardctl(t, dbFile, "decks", "--json")), &decks); e != nil {
+		t.Fatal(e)
+	}
+	if len(decks) != 1 || decks[0].Name != "Spanish" || decks[0].ViewLimit != 5 || decks[0].Cards != 2 {
+		t.Errorf("got decks: %+v", decks)
+	}
+
+	table := cardctl(t, dbFile, "cards", "-deck", "1")
+	for _, want := range []string{"FRONT", "hola", "goodbye", "never", "suspended"} {
+		if !strings.Contains(table, want) {
+			t.Errorf("card table missing %q:\n%s", want, table)
+		}
+	}
+
+	cardctl(t, dbFile, "remove", "1", "1")
+	if out := cardctl(t, dbFile, "-json", "cards", "-deck", "0"); !strings.Contains(out, "hola") {
+		t.Errorf("removed card not in the no-deck list: %s", out)
+	}
+
+	cardctl(t, dbFile, "deck", "rm", "1")
+	cardctl(t, dbFile, "card", "rm", "1")
+	if out := cardctl(t, dbFile, "-json", "cards"); strings.Contains(out, "hola") || !strings.Contains(out, "adios") {
+		t.Errorf("got cards: %s", out)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "cards.db")
+	cardctl(t, dbFile, "deck", "new", "Spanish")
+	cardctl(t, dbFile, "card", "new", "-front", "hola", "-deck", "1")
+	cardctl(t, dbFile, "card", "new", "-front", "adios", "-deck", "1")
+	cardctl(t, dbFile, "deck", "rm", "1")
+	cardctl(t, dbFile, "card", "rm", "1")
+	cardctl(t, dbFile, "card", "rm", "2")
+
+	var trash trashList
+	if e := json.Unmarshal([]byte(cardctl(t, dbFile, "-json", "trash", "list")), &trash); e != nil {
+		t.Fatal(e)
+	}
+	if len(trash.Decks) != 1 || len(trash.Cards) != 2 {
+		t.Errorf("got trash: %+v", trash)
+	}
+
+	cardctl(t, dbFile, "trash", "restore", "deck", "1")
+	cardctl(t, dbFile, "trash", "restore", "card", "1")
+	cardctl(t, dbFile, "trash", "purge", "card", "2")
+	if out := cardctl(t, dbFile, "cards", "-deck", "1"); !strings.Contains(out, "hola") || strings.Contains(out, "adios") {
+		t.Errorf("got cards:\n%s", out)
+	}
+
+	cardctl(t, dbFile, "card", "rm", "1")
+	cardctl(t, dbFile, "trash", "empty", "-older-than", "1h")
+	if out := cardctl(t, dbFile, "trash", "list"); !strings.Contains(out, "hola") {
+		t.Errorf("recently trashed card purged:\n%s", out)
+	}
+	cardctl(t, dbFile, "trash", "empty")
+	if out := cardctl(t, dbFile, "trash", "list"); strings.Contains(out, "hola") {
+		t.Errorf("trash not emptied:\n%s", out)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.db")
+	dst := filepath.Join(dir, "dst.db")
+	export := filepath.Join(dir, "export.json")
+
+	cardctl(t, src, "deck", "new", "A")
+	cardctl(t, src, "deck", "new", "B")
+	cardctl(t, src, "card", "new", "-front", "1", "-deck", "1", "-views", "3")
+	cardctl(t, src, "card", "new", "-front", "2", "-deck", "2")
+	cardctl(t, src, "add", "1", "2")
+	cardctl(t, src, "export", "-o", export)
+
+	cardctl(t, dst, "card", "new", "-front", "existing")
+	cardctl(t, dst, "import", export)
+
+	var stats allStats
+	if e := json.Unmarshal([]byte(cardctl(t, dst, "stats", "-json")), &stats); e != nil {
+		t.Fatal(e)
+	}
+	if len(stats.Decks) != 2 || stats.Decks[0].Cards != 1 || stats.Decks[1].Cards != 2 {
+		t.Errorf("got decks: %+v", stats.Decks)
+	}
+	if stats.Total.Cards != 3 || stats.Total.Views != 3 || stats.NoDeck.Cards != 1 {
+		t.Errorf("got totals: %+v no deck: %+v", stats.Total, stats.NoDeck)
+	}
+
+	// A deck referring to a missing card stops the import before anything is added
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{"Cards": [{"ID": 1, "Front": "new"}], "Decks": [{"Name": "C", "Cards": [1]}, {"Name": "D", "Cards": [2]}]}`), 0644)
+	if e := run([]string{"-db", dst, "import", bad}, &bytes.Buffer{}); e == nil {
+		t.Error("imported a deck with a missing card")
+	}
+	if out := cardctl(t, dst, "cards"); strings.Contains(out, "new") {
+		t.Errorf("failed import added cards: %s", out)
+	}
+
+	// So do repeated card IDs and a card listed twice in a deck
+	for _, content := range []string{
+		`{"Cards": [{"ID": 1, "Front": "new"}, {"ID": 1, "Front": "new again"}]}`,
+		`{"Cards": [{"ID": 1, "Front": "new"}], "Decks": [{"Name": "C", "Cards": [1]}, {"Name": "D", "Cards": [1, 1]}]}`,
+	} {
+		os.WriteFile(bad, []byte(content), 0644)
+		if e := run([]string{"-db", dst, "import", bad}, &bytes.Buffer{}); e == nil {
+			t.Errorf("imported %s", content)
+		}
+		if out := cardctl(t, dst, "cards"); strings.Contains(out, "new") {
+			t.Errorf("failed import added cards: %s", out)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "cards.db")
+	for _, args := range [][]string{
+		{},
+		{"bogus"},
+		{"deck"},
+		{"deck", "rm"},
+		{"deck", "rm", "1"},
+		{"card", "edit", "x"},
+		{"add", "1"},
+		{"trash", "restore", "deck", "1"},
+		{"trash", "purge", "bogus", "1"},
+	} {
+		if e := run(append([]string{"-db", dbFile}, args...), &bytes.Buffer{}); e == nil {
+			t.Errorf("cardctl %v succeeded", args)
+		}
+	}
+
+	// Bad command lines and help don't create the database
+	missing := filepath.Join(t.TempDir(), "missing.db")
+	for _, args := range [][]string{{"bogus"}, {"-h"}, {"deck", "new", "-h"}, {"card", "edit"}} {
+		run(append([]string{"-db", missing}, args...), &bytes.Buffer{})
+		if _, e := os.Stat(missing); !os.IsNotExist(e) {
+			t.Fatalf("cardctl %v created the database", args)
+		}
+	}
+}
+
+func TestStudy(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "cards.db")
+	cardctl(t, dbFile, "deck", "new", "Deck")
+	cardctl(t, dbFile, "card", "new", "-front", "question", "-back", "answer", "-deck", "1")
+
+	defer func(r io.Reader) { stdin = r }(stdin)
+	// Show the back and pass, show the back and fail, then undo the fail
+	stdin = strings.NewReader("  " + " a" + "u" + "q")
+	out := cardctl(t, dbFile, "-json", "study", "1")
+
+	if !strings.Contains(out, "question") || !strings.Contains(out, "answer") {
+		t.Errorf("card not shown:\n%s", out)
+	}
+	var res studyResult
+	if e := json.Unmarshal([]byte(out[strings.LastIndex(out, "{"):]), &res); e != nil {
+		t.Fatal(e)
+	}
+	if res != (studyResult{Deck: 1, Reviewed: 1, Again: 0}) {
+		t.Errorf("got: %+v", res)
+	}
+
+	// Viewed once for the pass and once more for showing the card again after the undo
+	var cards []*carddb.Card
+	if e := json.Unmarshal([]byte(cardctl(t, dbFile, "-json", "cards")), &cards); e != nil {
+		t.Fatal(e)
+	}
+	if cards[0].Views != 2 {
+		t.Errorf("got views: %d want: 2", cards[0].Views)
+	}
+
+	// The undone fail isn't in the history
+	db, e := carddb.OpenDatabase(dbFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer db.Close()
+	reviews, e := db.GetReviews(cards[0].ID)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(reviews) != 1 || reviews[0].Grade != carddb.GradeGood || reviews[0].DeckID != 1 {
+		t.Errorf("got reviews: %+v", reviews)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "cards.db")
+	backup := filepath.Join(dir, "backup.db")
+
+	cardctl(t, dbFile, "card", "new", "-front", "kept")
+	cardctl(t, dbFile, "backup", backup)
+	cardctl(t, dbFile, "card", "new", "-front", "lost")
+
+	if out := cardctl(t, dbFile, "restore", backup); !strings.Contains(out, "Restored") {
+		t.Errorf("got restore output: %s", out)
+	}
+	if out := cardctl(t, dbFile, "cards"); !strings.Contains(out, "kept") || strings.Contains(out, "lost") {
+		t.Errorf("got cards after restoring: %s", out)
+	}
+	old, e := filepath.Glob(dbFile + ".old-*[0-9]")
+	if e != nil || len(old) != 1 {
+		t.Fatalf("got replaced databases: %v, %v", old, e)
+	}
+	if out := cardctl(t, old[0], "cards"); !strings.Contains(out, "lost") {
+		t.Errorf("got replaced cards: %s", out)
+	}
+
+	var out bytes.Buffer
+	if e := run([]string{"-db", dbFile, "restore", filepath.Join(dir, "missing.db")}, &out); e == nil {
+		t.Error("restored a missing backup")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "cards.db")
+	cardctl(t, dbFile, "deck", "new", "Deck")
+	cardctl(t, dbFile, "card", "new", "-front", "hola", "-deck", "1")
+	if out := cardctl(t, dbFile, "check"); !strings.Contains(out, "No problems") {
+		t.Errorf("got check output: %s", out)
+	}
+
+	// Without foreign keys, as before they were enforced
+	raw, e := sql.Open("sqlite3", dbFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := raw.Exec(`INSERT INTO deck_card (deck_id, card_id) VALUES (1, 7); UPDATE card SET views=-1`); e != nil {
+		t.Fatal(e)
+	}
+	raw.Close()
+
+	var out bytes.Buffer
+	if e := run([]string{"-db", dbFile, "check"}, &out); e == nil || !strings.Contains(out.String(), "card 7") {
+		t.Errorf("got check output: %s, %v", out.String(), e)
+	}
+	if out := cardctl(t, dbFile, "check", "-fix"); strings.Count(out, "fixed:") != 2 {
+		t.Errorf("got fix output: %s", out)
+	}
+	if out := cardctl(t, dbFile, "cards", "-deck", "1"); !strings.Contains(out, "hola") {
+		t.Errorf("fixing removed the card from its deck: %s", out)
+	}
+	cardctl(t, dbFile, "check")
+}
+
+func TestStudyTyped(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "cards.db")
+	cardctl(t, dbFile, "deck", "new", "Deck", "-type-answer", "-leech-threshold", "1")
+	cardctl(t, dbFile, "card", "new", "-front", "question", "-back", "answer", "-deck", "1")
+
+	defer func(r io.Reader) { stdin = r }(stdin)
+	// Type a correct answer with a correction, go on, type a wrong one, go on and quit
+	stdin = strings.NewReader("answex\x7fr\r" + " " + "wrong\r" + " " + "q")
+	out := cardctl(t, dbFile, "-json", "study", "1")
+	if !strings.Contains(out, "(Correct)") || !strings.Contains(out, "(Incorrect)") {
+		t.Errorf("answers not checked:\n%s", out)
+	}
+	var res studyResult
+	if e := json.Unmarshal([]byte(out[strings.LastIndex(out, "{"):]), &res); e != nil {
+		t.Fatal(e)
+	}
+	if res != (studyResult{Deck: 1, Reviewed: 2, Again: 1}) {
+		t.Errorf("got: %+v", res)
+	}
+
+	db, e := carddb.OpenDatabase(dbFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer db.Close()
+	reviews, e := db.GetReviews(1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(reviews) != 2 || reviews[0].Grade != carddb.GradeIncorrect || reviews[0].Answer != "wrong" ||
+		reviews[1].Grade != carddb.GradeCorrect || reviews[1].Answer != "answer" {
+		t.Errorf("got reviews: %+v", reviews)
+	}
+	// Grades go through the revision history and the failure made the card a leech. It was
+	// viewed for the pass and when shown before quitting, but not for the failure.
+	if revs, _ := db.GetRevisions(carddb.KindCard, 1); len(revs) < 2 || revs[0].Action != carddb.ActionGrade {
+		t.Errorf("got revisions: %+v", revs)
+	}
+	if card := db.GetCard(1); card == nil || !card.Leech || card.Views != 2 {
+		t.Errorf("got card: %+v", card)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// cardStats summarizes a set of cards
+type cardStats struct {
+	Cards       int
+	Views       int
+	NeverViewed int
+	AvgViews    float64
+	LastView    *time.Time `json:",omitempty"`
+}
+
+func summarize(cards []*carddb.Card) cardStats {
+	s := cardStats{Cards: len(cards)}
+	for _, c := range cards {
+		s.Views += c.Views
+		if c.LastView.Year() <= 1 {
+			s.NeverViewed++
+		} else if s.LastView == nil || c.LastView.After(*s.LastView) {
+			last := c.LastView
+			s.LastView = &last
+		}
+	}
+	if s.Cards > 0 {
+		s.AvgViews = float64(s.Views) / float64(s.Cards)
+	}
+	return s
+}
+
+func (s cardStats) row() []string {
+	last := "never"
+	if s.LastView != nil {
+		last = s.LastView.Format("2006-01-02 15:04")
+	}
+	return []string{
+		strconv.Itoa(s.Cards),
+		strconv.Itoa(s.Views),
+		strconv.Itoa(s.NeverViewed),
+		strconv.FormatFloat(s.AvgViews, 'f', 1, 64),
+		last,
+	}
+}
+
+// deckStats are the stats of one deck
+type deckStats struct {
+	ID   int
+	Name string
+	cardStats
+}
+
+// allStats is the JSON output of stats
+type allStats struct {
+	Decks  []deckStats
+	NoDeck cardStats
+	Total  cardStats
+}
+
+func showStats(en *env, args []string) error {
+	fs := en.flags()
+	deckID := fs.Int("deck", -1, "Only show stats for this deck")
+	if _, e := en.parse(fs, args, 0); e != nil {
+		return e
+	}
+
+	var decks []*carddb.Deck
+	if *deckID >= 0 {
+		deck, e := en.getDeck(strconv.Itoa(*deckID))
+		if e != nil {
+			return e
+		}
+		decks = []*carddb.Deck{deck}
+	} else {
+		var e error
+		if decks, e = en.sortedDecks(); e != nil {
+			return e
+		}
+	}
+
+	header := []string{"ID", "DECK", "CARDS", "VIEWS", "NEVER VIEWED", "AVG VIEWS", "LAST VIEW"}
+	var rows [][]string
+	stats := allStats{}
+	for _, deck := range decks {
+		cards, e := en.db.GetCards(deck.ID)
+		if e != nil {
+			return e
+		}
+		s := deckStats{deck.ID, deck.Name, summarize(cards)}
+		stats.Decks = append(stats.Decks, s)
+		rows = append(rows, append([]string{strconv.Itoa(deck.ID), deck.Name}, s.row()...))
+	}
+
+	if *deckID >= 0 {
+		return en.print(stats.Decks[0], header, rows)
+	}
+
+	noDeck, e := en.db.GetCards(0)
+	if e != nil {
+		return e
+	}
+	all, e := en.db.GetCards(-1)
+	if e != nil {
+		return e
+	}
+	stats.NoDeck = summarize(noDeck)
+	stats.Total = summarize(all)
+	rows = append(rows,
+		append([]string{"", "(no deck)"}, stats.NoDeck.row()...),
+		append([]string{"", "(total)"}, stats.Total.row()...))
+
+	return en.print(stats, header, rows)
+}
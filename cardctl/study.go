@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Bredgren/cards/carddb"
+	"golang.org/x/term"
+)
+
+// stdin is where study reads keys from
+var stdin io.Reader = os.Stdin
+
+const (
+	studyHelp = "[space] show back / next  [a] again  [u] undo  [q] quit"
+	// typedHelp is shown for decks that ask for typed answers
+	typedHelp   = "Type the back and press [enter] to check it  [ctrl-d] quit"
+	checkedHelp = "[space] next  [u] undo  [q] quit"
+)
+
+// studyResult is the summary printed when a study session ends
+type studyResult struct {
+	Deck     int
+	Reviewed int
+	Again    int
+}
+
+// answer is a card shown during the session with its state from before it was shown,
+// so showing and grading it can be undone
+type answer struct {
+	card   *carddb.Card
+	before carddb.Card
+	shown  time.Time
+	// again is set when the card was failed
+	again bool
+	// rev is the revision made by grading the card, reverted by undo
+	rev *carddb.Revision
+	// typed and result are the typed answer and how it was checked, for decks that ask
+	// for typed answers
+	typed  string
+	result *carddb.AnswerResult
+}
+
+// studySession studies a deck the same way the web Study page does: each card is picked
+// and viewed with StudyCard when shown, graded with GradeCard and checked for being a
+// leech when failed, and failing takes the view back off. Decks with TypeAnswer ask for
+// the back to be typed and grade it with CheckAnswer.
+type studySession struct {
+	db   *carddb.Database
+	deck *carddb.Deck
+	keys *bufio.Reader
+	out  io.Writer
+	// clear is written before showing each card
+	clear string
+
+	current  *answer
+	history  []*answer
+	reviewed int
+	again    int
+}
+
+func study(en *env, args []string) error {
+	pos, e := en.parse(en.flags(), args, 1)
+	if e != nil {
+		return e
+	}
+	deck, e := en.getDeck(pos[0])
+	if e != nil {
+		return e
+	}
+
+	s := &studySession{db: en.db, deck: deck, keys: bufio.NewReader(stdin), out: en.out}
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		state, e := term.MakeRaw(int(f.Fd()))
+		if e != nil {
+			return e
+		}
+		defer term.Restore(int(f.Fd()), state)
+		s.clear = "\x1b[2J\x1b[H"
+	}
+
+	if e := s.run(); e != nil {
+		return e
+	}
+
+	res := studyResult{deck.ID, s.reviewed, s.again}
+	return en.printf(res, "Reviewed %d cards from '%s', %d again\r\n", res.Reviewed, deck.Name, res.Again)
+}
+
+// println writes a line. In raw mode the terminal doesn't return the cursor on \n.
+func (s *studySession) println(line string) {
+	fmt.Fprint(s.out, line+"\r\n")
+}
+
+// key returns the next key pressed, or 'q' at the end of input
+func (s *studySession) key() byte {
+	b, e := s.keys.ReadByte()
+	// Ctrl-C and Ctrl-D don't send signals in raw mode
+	if e != nil || b == 3 || b == 4 {
+		return 'q'
+	}
+	return b
+}
+
+// readLine reads a typed answer, echoing it, until enter is pressed. It returns false if
+// the user quits instead.
+func (s *studySession) readLine() (string, bool) {
+	var line []byte
+	for {
+		b, e := s.keys.ReadByte()
+		switch {
+		case e != nil || b == 3 || b == 4:
+			return "", false
+		case b == '\r' || b == '\n':
+			s.println("")
+			return string(line), true
+		case b == 127 || b == 8:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				fmt.Fprint(s.out, "\b \b")
+			}
+		default:
+			line = append(line, b)
+			fmt.Fprint(s.out, string(b))
+		}
+	}
+}
+
+// next shows a new card, logging a view of it
+func (s *studySession) next() error {
+	card, before, e := s.db.StudyCard(s.deck)
+	if e != nil || card == nil {
+		s.current = nil
+		return e
+	}
+	s.current = &answer{card: card, before: *before, shown: time.Now()}
+	return nil
+}
+
+// undo puts the current card back the way it was before it was shown, then reverts the
+// grade of the last answered card and shows it again
+func (s *studySession) undo() error {
+	if len(s.history) == 0 {
+		return nil
+	}
+	if c := s.current; c != nil && c.rev == nil {
+		*c.card = c.before
+		if e := s.db.UpdateCard(c.card); e != nil {
+			return e
+		}
+	}
+
+	last := s.history[len(s.history)-1]
+	s.history = s.history[:len(s.history)-1]
+	if _, e := s.db.Revert(last.rev.ID, author()); e != nil {
+		return e
+	}
+	s.reviewed--
+	if last.again {
+		s.again--
+	}
+
+	*last.card = last.before
+	s.current = &answer{card: last.card, before: last.before, shown: time.Now()}
+	return s.db.ViewCard(last.card)
+}
+
+// grade records the grade of the current card. Failing takes the view back off, the same
+// as the -1 link on the web Study page, and checks if the card is now a leech.
+func (s *studySession) grade(grade string) error {
+	c := s.current
+	c.again = !carddb.Passed(grade)
+	if c.again {
+		c.card.Views--
+	}
+	rev, e := s.db.GradeCard(&c.before, c.card, &carddb.Review{
+		CardID:   c.card.ID,
+		DeckID:   s.deck.ID,
+		Grade:    grade,
+		Answer:   c.typed,
+		Duration: time.Since(c.shown),
+	}, author())
+	if e != nil {
+		return e
+	}
+	if c.again {
+		if _, e := s.db.CheckLeech(s.deck, c.card); e != nil {
+			return e
+		}
+		s.again++
+	}
+	c.rev = rev
+	s.history = append(s.history, c)
+	s.reviewed++
+	return nil
+}
+
+// check grades a typed answer to the current card
+func (s *studySession) check(typed string) error {
+	res := carddb.CheckAnswer(typed, s.current.card.Back)
+	s.current.typed, s.current.result = typed, &res
+	if res.Correct {
+		return s.grade(carddb.GradeCorrect)
+	}
+	return s.grade(carddb.GradeIncorrect)
+}
+
+func (s *studySession) show(back bool) {
+	c := s.current
+	fmt.Fprint(s.out, s.clear)
+	leech := ""
+	if c.card.Leech {
+		leech = " [leech]"
+	}
+	s.println(fmt.Sprintf("%s - card #%d (views: %d)%s", s.deck.Name, c.card.ID, c.card.Views, leech))
+	s.println("")
+	s.println("  " + strings.ReplaceAll(c.card.Front, "\n", "\r\n  "))
+	s.println("")
+	if c.result != nil {
+		verdict := "Correct"
+		if !c.result.Correct {
+			verdict = "Incorrect"
+		}
+		s.println(fmt.Sprintf("  You typed: %s (%s)", c.typed, verdict))
+		s.println("")
+	}
+	if back {
+		s.println("  " + strings.ReplaceAll(c.card.Back, "\n", "\r\n  "))
+		s.println("")
+	}
+	switch {
+	case !s.deck.TypeAnswer:
+		s.println(studyHelp)
+	case back:
+		s.println(checkedHelp)
+	default:
+		s.println(typedHelp)
+	}
+}
+
+// run studies until the user quits or the deck is empty
+func (s *studySession) run() error {
+	if e := s.next(); e != nil {
+		return e
+	}
+
+	back := false
+	for s.current != nil {
+		s.show(back)
+
+		if s.deck.TypeAnswer && !back {
+			typed, ok := s.readLine()
+			if !ok {
+				return nil
+			}
+			if e := s.check(typed); e != nil {
+				return e
+			}
+			back = true
+			continue
+		}
+
+		switch key := s.key(); {
+		case key == 'q':
+			return nil
+		case key == 'u':
+			if e := s.undo(); e != nil {
+				return e
+			}
+			back = false
+		case !back && !s.deck.TypeAnswer && (key == ' ' || key == '\r' || key == '\n' || key == 'g'):
+			back = true
+		case back && !s.deck.TypeAnswer && (key == 'a' || key == '-'):
+			if e := s.grade(carddb.GradeAgain); e != nil {
+				return e
+			}
+			if e := s.next(); e != nil {
+				return e
+			}
+			back = false
+		case back && (key == ' ' || key == '\r' || key == '\n' || key == 'g'):
+			if !s.deck.TypeAnswer {
+				if e := s.grade(carddb.GradeGood); e != nil {
+					return e
+				}
+			}
+			if e := s.next(); e != nil {
+				return e
+			}
+			back = false
+		}
+	}
+
+	s.println("The deck is empty.")
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// archive is the format written by export and read by import. Cards keep their stats.
+// IDs are only used to link decks to cards; imported items get new IDs.
+type archive struct {
+	Decks []archiveDeck
+	Cards []*carddb.Card
+}
+
+// archiveDeck is a deck with the IDs of its cards
+type archiveDeck struct {
+	*carddb.Deck
+	Cards []int
+}
+
+func exportCards(en *env, args []string) error {
+	fs := en.flags()
+	outFile := fs.String("o", "-", "Output file, - for standard output")
+	if _, e := en.parse(fs, args, 0); e != nil {
+		return e
+	}
+
+	a := archive{}
+	var e error
+	if a.Cards, e = en.db.GetCards(-1); e != nil {
+		return e
+	}
+	sort.Sort(carddb.CardsByID(a.Cards))
+
+	decks, e := en.sortedDecks()
+	if e != nil {
+		return e
+	}
+	for _, deck := range decks {
+		cards, e := en.db.GetCards(deck.ID)
+		if e != nil {
+			return e
+		}
+		sort.Sort(carddb.CardsByID(cards))
+		ids := make([]int, len(cards))
+		for i, c := range cards {
+			ids[i] = c.ID
+		}
+		a.Decks = append(a.Decks, archiveDeck{deck, ids})
+	}
+
+	out := en.out
+	if *outFile != "-" {
+		f, e := os.Create(*outFile)
+		if e != nil {
+			return e
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if e := enc.Encode(a); e != nil {
+		return e
+	}
+
+	if *outFile != "-" && !en.json {
+		fmt.Fprintf(en.out, "Exported %d decks and %d cards to %s\n", len(a.Decks), len(a.Cards), *outFile)
+	}
+	return nil
+}
+
+// importResult is the JSON output of import, mapping IDs in the file to the new IDs
+type importResult struct {
+	Decks map[int]int
+	Cards map[int]int
+}
+
+func importCards(en *env, args []string) error {
+	pos, e := en.parse(en.flags(), args, 1)
+	if e != nil {
+		return e
+	}
+
+	var in io.Reader = os.Stdin
+	if pos[0] != "-" {
+		f, e := os.Open(pos[0])
+		if e != nil {
+			return e
+		}
+		defer f.Close()
+		in = f
+	}
+	a := archive{}
+	if e := json.NewDecoder(in).Decode(&a); e != nil {
+		return fmt.Errorf("reading %s: %v", pos[0], e)
+	}
+
+	// Check the whole file first for mistakes that would make the import fail part way.
+	// The import itself is one transaction, so anything else that fails adds nothing.
+	inFile := make(map[int]bool)
+	for i, c := range a.Cards {
+		if c == nil {
+			return fmt.Errorf("card %d in %s is empty", i+1, pos[0])
+		}
+		if inFile[c.ID] {
+			return fmt.Errorf("card ID %d is in %s more than once", c.ID, pos[0])
+		}
+		inFile[c.ID] = true
+	}
+	var decks []carddb.ImportDeck
+	for _, d := range a.Decks {
+		if d.Deck == nil {
+			continue
+		}
+		inDeck := make(map[int]bool)
+		for _, oldID := range d.Cards {
+			if !inFile[oldID] {
+				return fmt.Errorf("deck '%s' refers to card %d which is not in the file", d.Name, oldID)
+			}
+			if inDeck[oldID] {
+				return fmt.Errorf("deck '%s' lists card %d more than once", d.Name, oldID)
+			}
+			inDeck[oldID] = true
+		}
+		decks = append(decks, carddb.ImportDeck{Deck: d.Deck, Cards: d.Cards})
+	}
+
+	res := importResult{}
+	if res.Cards, res.Decks, e = en.db.Import(a.Cards, decks); e != nil {
+		return e
+	}
+	return en.printf(res, "Imported %d decks and %d cards\n", len(res.Decks), len(res.Cards))
+}
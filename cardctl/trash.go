@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// trashList is the output of trash list
+type trashList struct {
+	Decks []*carddb.TrashedDeck
+	Cards []*carddb.TrashedCard
+}
+
+func listTrash(en *env, args []string) error {
+	if _, e := en.parse(en.flags(), args, 0); e != nil {
+		return e
+	}
+
+	decks, cards, e := en.db.GetTrash()
+	if e != nil {
+		return e
+	}
+
+	var rows [][]string
+	for _, d := range decks {
+		rows = append(rows, []string{"deck", strconv.Itoa(d.ID), d.Name, d.Deleted.Format("2006-01-02 15:04")})
+	}
+	for _, c := range cards {
+		rows = append(rows, []string{"card", strconv.Itoa(c.ID), c.Front, c.Deleted.Format("2006-01-02 15:04")})
+	}
+	return en.print(trashList{decks, cards}, []string{"TYPE", "ID", "NAME", "DELETED"}, rows)
+}
+
+// trashItem parses the deck|card <id> arguments of trash restore and trash purge
+func trashItem(en *env, args []string) (kind string, id int, e error) {
+	pos, e := en.parse(en.flags(), args, 2)
+	if e != nil {
+		return "", 0, e
+	}
+	kind = pos[0]
+	if kind != "deck" && kind != "card" {
+		return "", 0, fmt.Errorf("%s: expected deck or card, got %q", en.command, kind)
+	}
+	id, e = atoi(kind, pos[1])
+	return kind, id, e
+}
+
+func restoreTrash(en *env, args []string) error {
+	kind, id, e := trashItem(en, args)
+	if e != nil {
+		return e
+	}
+	if kind == "deck" {
+		e = en.db.RestoreDeck(id)
+	} else {
+		e = en.db.RestoreCard(id)
+	}
+	if e != nil {
+		return e
+	}
+
+	return en.printf(map[string]int{kind: id}, "Restored %s %d\n", kind, id)
+}
+
+func purgeTrash(en *env, args []string) error {
+	kind, id, e := trashItem(en, args)
+	if e != nil {
+		return e
+	}
+	if kind == "deck" {
+		e = en.db.PurgeDeck(id)
+	} else {
+		e = en.db.PurgeCard(id)
+	}
+	if e != nil {
+		return e
+	}
+
+	return en.printf(map[string]int{kind: id}, "Permanently deleted %s %d\n", kind, id)
+}
+
+func emptyTrash(en *env, args []string) error {
+	fs := en.flags()
+	olderThan := fs.Duration("older-than", 0, "Only delete items trashed at least this long ago")
+	if _, e := en.parse(fs, args, 0); e != nil {
+		return e
+	}
+
+	decks, cards, e := en.db.PurgeTrash(time.Now().Add(-*olderThan))
+	if e != nil {
+		return e
+	}
+
+	res := struct{ Decks, Cards int }{decks, cards}
+	return en.printf(res, "Permanently deleted %d decks and %d cards\n", decks, cards)
+}
@@ -0,0 +1,172 @@
+package carddb
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// AnswerTolerance is the fraction of the expected answer's characters that may be wrong
+// for a typed answer to still count as correct
+var AnswerTolerance = 0.2
+
+// maxExtraTyped is how many characters past twice the expected answer's length CheckAnswer
+// compares. The diff takes time and memory proportional to the product of the lengths, and
+// anything longer is wrong anyway.
+const maxExtraTyped = 10
+
+// NormalizeAnswer puts an answer in the form used for comparing: lower case, without
+// accents or punctuation, and with runs of white space replaced by a single space.
+func NormalizeAnswer(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	if stripped, _, e := transform.String(t, s); e == nil {
+		s = stripped
+	}
+
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// DiffOp is the kind of a DiffSegment
+type DiffOp int
+
+// Kinds of DiffSegment
+const (
+	// DiffEqual text is the same in both answers
+	DiffEqual DiffOp = iota
+	// DiffMissing text is in the expected answer but wasn't typed
+	DiffMissing
+	// DiffExtra text was typed but isn't in the expected answer
+	DiffExtra
+)
+
+// DiffSegment is a run of characters in a character-level diff
+type DiffSegment struct {
+	Op   DiffOp
+	Text string
+}
+
+// Equal, Missing and Extra are for templates
+func (d DiffSegment) Equal() bool   { return d.Op == DiffEqual }
+func (d DiffSegment) Missing() bool { return d.Op == DiffMissing }
+func (d DiffSegment) Extra() bool   { return d.Op == DiffExtra }
+
+// AnswerResult is the outcome of checking a typed answer
+type AnswerResult struct {
+	Correct bool
+	// Distance is the edit distance between the normalized answers
+	Distance int
+	// Diff turns the normalized typed answer into the normalized expected answer
+	Diff []DiffSegment
+}
+
+// CheckAnswer compares a typed answer to the expected one. They're normalized with
+// NormalizeAnswer and the answer is correct if the edit distance between them is within
+// AnswerTolerance. Only the start of a typed answer much longer than the expected one is
+// compared.
+func CheckAnswer(typed, expected string) AnswerResult {
+	b := []rune(NormalizeAnswer(expected))
+	a := []rune(NormalizeAnswer(typed))
+	if limit := 2*len(b) + maxExtraTyped; len(a) > limit {
+		a = a[:limit]
+	}
+	res := AnswerResult{}
+	res.Distance, res.Diff = diff(a, b)
+	res.Correct = float64(res.Distance) <= AnswerTolerance*float64(len(b))
+	return res
+}
+
+// maxDiffCells limits the size of the table Diff builds, which is the product of the
+// lengths of the texts
+const maxDiffCells = 1 << 20
+
+// Diff returns a character-level diff turning from into to. Text only in from is
+// DiffExtra and text only in to is DiffMissing. It returns nil for texts too long to
+// compare cheaply.
+func Diff(from, to string) []DiffSegment {
+	a, b := []rune(from), []rune(to)
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		return nil
+	}
+	_, d := diff(a, b)
+	return d
+}
+
+// diff returns the edit distance between a and b and the diff turning a into b
+func diff(a, b []rune) (int, []DiffSegment) {
+	// dist[i][j] is the edit distance between a[i:] and b[j:]
+	dist := make([][]int, len(a)+1)
+	for i := range dist {
+		dist[i] = make([]int, len(b)+1)
+	}
+	for i := len(a); i >= 0; i-- {
+		for j := len(b); j >= 0; j-- {
+			switch {
+			case i == len(a):
+				dist[i][j] = len(b) - j
+			case j == len(b):
+				dist[i][j] = len(a) - i
+			case a[i] == b[j]:
+				dist[i][j] = dist[i+1][j+1]
+			default:
+				dist[i][j] = 1 + min(dist[i+1][j+1], dist[i+1][j], dist[i][j+1])
+			}
+		}
+	}
+
+	// Walk the table to build the diff. Within a run of changes the extra characters are
+	// grouped before the missing ones so a mistyped word reads as a whole.
+	var segs []DiffSegment
+	var extra, missing, equal []rune
+	flush := func() {
+		for _, seg := range []DiffSegment{{DiffExtra, string(extra)}, {DiffMissing, string(missing)},
+			{DiffEqual, string(equal)}} {
+			if seg.Text != "" {
+				segs = append(segs, seg)
+			}
+		}
+		extra, missing, equal = nil, nil, nil
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			if len(extra) > 0 || len(missing) > 0 {
+				flush()
+			}
+			equal = append(equal, a[i])
+			i++
+			j++
+		case i < len(a) && j < len(b) && dist[i][j] == 1+dist[i+1][j+1]:
+			if len(equal) > 0 {
+				flush()
+			}
+			extra = append(extra, a[i])
+			missing = append(missing, b[j])
+			i++
+			j++
+		case i < len(a) && dist[i][j] == 1+dist[i+1][j]:
+			if len(equal) > 0 {
+				flush()
+			}
+			extra = append(extra, a[i])
+			i++
+		default:
+			if len(equal) > 0 {
+				flush()
+			}
+			missing = append(missing, b[j])
+			j++
+		}
+	}
+	flush()
+	return dist[0][0], segs
+}
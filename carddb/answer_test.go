@@ -0,0 +1,62 @@
+package carddb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeAnswer(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"Hello", "hello"},
+		{"  two\t words \n", "two words"},
+		{"Café crème", "cafe creme"},
+		{"Don't stop!", "dont stop"},
+		{"¿Qué tal?", "que tal"},
+	}
+	for _, c := range cases {
+		if got := NormalizeAnswer(c.in); got != c.want {
+			t.Errorf("NormalizeAnswer(%q) got: %q want: %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestCheckAnswer(t *testing.T) {
+	cases := []struct {
+		typed, expected string
+		correct         bool
+		distance        int
+	}{
+		{"hello", "Hello!", true, 0},
+		{"helo", "hello", true, 1},
+		{"cafe", "café", true, 0},
+		{"cat", "car", false, 1},
+		{"", "answer", false, 6},
+		{"something else", "answer", false, 12},
+		// Only the first 2*6+10 characters are compared
+		{strings.Repeat("answer ", 1<<20), "answer", false, 16},
+	}
+	for _, c := range cases {
+		got := CheckAnswer(c.typed, c.expected)
+		if got.Correct != c.correct || got.Distance != c.distance {
+			t.Errorf("CheckAnswer(%q, %q) got: %v, %d want: %v, %d",
+				c.typed, c.expected, got.Correct, got.Distance, c.correct, c.distance)
+		}
+	}
+}
+
+func TestCheckAnswerDiff(t *testing.T) {
+	got := CheckAnswer("the quick frog", "The quick fox").Diff
+	want := []DiffSegment{
+		{DiffEqual, "the quick f"},
+		{DiffExtra, "r"},
+		{DiffEqual, "o"},
+		{DiffExtra, "g"},
+		{DiffMissing, "x"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %#v want: %#v", got, want)
+	}
+}
@@ -0,0 +1,174 @@
+package carddb
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotPrefix and snapshotTimeFormat name the files made by Snapshot, which sort in
+// the order they were taken. Names have microseconds so snapshots taken in the same
+// second don't clash; parsing accepts names without them too.
+const (
+	snapshotPrefix     = "cards-"
+	snapshotTimeFormat = "20060102-150405"
+	fileTimeFormat     = snapshotTimeFormat + ".000000"
+)
+
+// Backup writes a consistent copy of the database to fileName with VACUUM INTO, which is
+// safe while the database is in use. fileName must not already exist.
+func (db *Database) Backup(fileName string) error {
+	defer db.observe("Backup", time.Now())
+	if _, e := os.Stat(fileName); e == nil {
+		return fmt.Errorf("%s already exists", fileName)
+	}
+	_, e := db.Exec(`VACUUM INTO ?`, fileName)
+	return e
+}
+
+// Snapshot backs the database up to a new file in dir named after the current time and
+// deletes all but the newest keep snapshots there. keep <= 0 keeps them all. It returns the
+// new snapshot's file name.
+func (db *Database) Snapshot(dir string, keep int) (string, error) {
+	if e := os.MkdirAll(dir, 0755); e != nil {
+		return "", e
+	}
+	fileName := filepath.Join(dir, snapshotPrefix+time.Now().UTC().Format(fileTimeFormat)+".db")
+	if e := db.Backup(fileName); e != nil {
+		return "", e
+	}
+	if keep <= 0 {
+		return fileName, nil
+	}
+
+	snapshots, e := Snapshots(dir)
+	if e != nil {
+		return fileName, e
+	}
+	for len(snapshots) > keep {
+		if e := os.Remove(snapshots[0]); e != nil {
+			return fileName, e
+		}
+		snapshots = snapshots[1:]
+	}
+	return fileName, nil
+}
+
+// Snapshots returns the files made by Snapshot in dir, oldest first
+func Snapshots(dir string) ([]string, error) {
+	files, e := filepath.Glob(filepath.Join(dir, snapshotPrefix+"*.db"))
+	if e != nil {
+		return nil, e
+	}
+	var snapshots []string
+	for _, f := range files {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), snapshotPrefix), ".db")
+		if _, e := time.Parse(snapshotTimeFormat, stamp); e == nil {
+			snapshots = append(snapshots, f)
+		}
+	}
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+// CheckBackup returns the schema version of the backup in fileName, or an error if it
+// isn't an intact card database this package can open
+func CheckBackup(fileName string) (int, error) {
+	if _, e := os.Stat(fileName); e != nil {
+		return 0, e
+	}
+	// Escaped so '?' and '#' in the name aren't read as part of the URI
+	uri := url.URL{Scheme: "file", Opaque: (&url.URL{Path: fileName}).EscapedPath(), RawQuery: "mode=ro"}
+	db, e := sql.Open("sqlite3", uri.String())
+	if e != nil {
+		return 0, e
+	}
+	defer db.Close()
+
+	var result string
+	if e := db.QueryRow(`PRAGMA integrity_check`).Scan(&result); e != nil {
+		return 0, fmt.Errorf("%s: %v", fileName, e)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("%s is corrupt: %s", fileName, result)
+	}
+	var tables int
+	e = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name IN ('deck', 'card', 'deck_card')`).
+		Scan(&tables)
+	if e != nil {
+		return 0, e
+	}
+	if tables != 3 {
+		return 0, fmt.Errorf("%s is not a card database", fileName)
+	}
+
+	var version int
+	if e := db.QueryRow(`PRAGMA user_version`).Scan(&version); e != nil {
+		return 0, e
+	}
+	if version > SchemaVersion {
+		return version, fmt.Errorf("%s has schema version %d, newer than supported version %d",
+			fileName, version, SchemaVersion)
+	}
+	// Databases from before schema versions were recorded are version 1
+	if version < 1 {
+		version = 1
+	}
+	return version, nil
+}
+
+// Restore replaces the database file fileName with the backup after checking it with
+// CheckBackup. The replaced file, if there was one, is kept as fileName + ".old-" and the
+// time, which is returned. Nothing may have fileName open. Older backups are migrated when
+// next opened.
+func Restore(backup, fileName string) (string, error) {
+	if _, e := CheckBackup(backup); e != nil {
+		return "", e
+	}
+	old := ""
+	if _, e := os.Stat(fileName); e == nil {
+		old = fileName + ".old-" + time.Now().UTC().Format(fileTimeFormat)
+		if _, e := os.Stat(old); e == nil {
+			return "", fmt.Errorf("%s already exists", old)
+		}
+	}
+
+	// Copy next to the database first so the swap is a rename
+	tmp, e := os.CreateTemp(filepath.Dir(fileName), ".carddb-restore-*")
+	if e != nil {
+		return "", e
+	}
+	defer os.Remove(tmp.Name())
+	src, e := os.Open(backup)
+	if e != nil {
+		tmp.Close()
+		return "", e
+	}
+	_, e = io.Copy(tmp, src)
+	src.Close()
+	if e == nil {
+		e = tmp.Sync()
+	}
+	if e2 := tmp.Close(); e == nil {
+		e = e2
+	}
+	if e != nil {
+		return "", e
+	}
+
+	// The journal files go with the replaced file so SQLite finds them if it's opened
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		if _, e := os.Stat(fileName + suffix); e == nil && old != "" {
+			if e := os.Rename(fileName+suffix, old+suffix); e != nil {
+				return "", e
+			}
+		}
+	}
+	return old, os.Rename(tmp.Name(), fileName)
+}
@@ -0,0 +1,150 @@
+package carddb
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+	deck, _ := db.NewDeck("Backed Up")
+
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "backup.db")
+	if e := db.Backup(backup); e != nil {
+		t.Fatal(e)
+	}
+	if e := db.Backup(backup); e == nil {
+		t.Error("overwrote a backup")
+	}
+	if version, e := CheckBackup(backup); e != nil || version != SchemaVersion {
+		t.Errorf("got backup version %d: %v", version, e)
+	}
+
+	live := filepath.Join(dir, "cards.db")
+	liveDB, e := OpenDatabase(live)
+	if e != nil {
+		t.Fatal(e)
+	}
+	liveDB.NewDeck("Replaced")
+	liveDB.Close()
+
+	old, e := Restore(backup, live)
+	if e != nil {
+		t.Fatal(e)
+	}
+	// Not OpenDatabase, which drops the tables in tests
+	restored, e := sql.Open("sqlite3", live)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer restored.Close()
+	var name string
+	if e := restored.QueryRow(`SELECT name FROM deck WHERE deck_id=?`, deck.ID).Scan(&name); e != nil || name != "Backed Up" {
+		t.Errorf("got restored deck %q: %v", name, e)
+	}
+	if _, e := os.Stat(old); e != nil || !strings.HasPrefix(old, live+".old-") {
+		t.Errorf("replaced database not kept as %q: %v", old, e)
+	}
+
+	// Restoring again keeps both replaced databases
+	again, e := Restore(backup, live)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := os.Stat(again); e != nil || again == old {
+		t.Errorf("second replaced database not kept as %q: %v", again, e)
+	}
+	if _, e := os.Stat(old); e != nil {
+		t.Errorf("first replaced database lost: %v", e)
+	}
+	if version, e := CheckBackup(old); e != nil || version != SchemaVersion {
+		t.Errorf("got first replaced database version %d: %v", version, e)
+	}
+}
+
+func TestCheckBackup(t *testing.T) {
+	dir := t.TempDir()
+
+	notDB := filepath.Join(dir, "not.db")
+	os.WriteFile(notDB, []byte("not a database"), 0644)
+	if _, e := CheckBackup(notDB); e == nil {
+		t.Error("accepted a text file")
+	}
+
+	newer := filepath.Join(dir, "newer.db")
+	db, e := OpenDatabase(newer)
+	if e != nil {
+		t.Fatal(e)
+	}
+	db.Exec(`PRAGMA user_version = 1000`)
+	db.Close()
+	if _, e := CheckBackup(newer); e == nil {
+		t.Error("accepted a newer schema version")
+	}
+	live := filepath.Join(dir, "cards.db")
+	if _, e := Restore(newer, live); e == nil {
+		t.Error("restored a newer schema version")
+	}
+	if _, e := os.Stat(live); !os.IsNotExist(e) {
+		t.Errorf("failed restore created the database: %v", e)
+	}
+}
+
+func TestCheckBackupName(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+	backup := filepath.Join(t.TempDir(), "odd?name#1 %20.db")
+	if e := db.Backup(backup); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := CheckBackup(backup); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"cards-20200101-000000.db", "cards-20200102-000000.db", "other.db"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	snapshot, e := db.Snapshot(dir, 2)
+	if e != nil {
+		t.Fatal(e)
+	}
+	snapshots, e := Snapshots(dir)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(snapshots) != 2 || filepath.Base(snapshots[0]) != "cards-20200102-000000.db" || snapshots[1] != snapshot {
+		t.Errorf("got snapshots: %v", snapshots)
+	}
+	if _, e := os.Stat(filepath.Join(dir, "other.db")); e != nil {
+		t.Errorf("other file removed: %v", e)
+	}
+
+	// Snapshots in the same second get different names
+	next, e := db.Snapshot(dir, 0)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if next == snapshot {
+		t.Errorf("got the same snapshot twice: %s", next)
+	}
+}
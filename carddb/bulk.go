@@ -0,0 +1,190 @@
+package carddb
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Bulk actions
+const (
+	BulkMove      = "move"
+	BulkCopy      = "copy"
+	BulkRemove    = "remove"
+	BulkDelete    = "delete"
+	BulkTag       = "tag"
+	BulkUntag     = "untag"
+	BulkReset     = "reset"
+	BulkSuspend   = "suspend"
+	BulkUnsuspend = "unsuspend"
+)
+
+// bulkVerbs describe the bulk actions for summaries
+var bulkVerbs = map[string]string{
+	BulkMove:      "Moved",
+	BulkCopy:      "Copied",
+	BulkRemove:    "Removed",
+	BulkDelete:    "Moved to the trash",
+	BulkTag:       "Tagged",
+	BulkUntag:     "Untagged",
+	BulkReset:     "Reset",
+	BulkSuspend:   "Suspended",
+	BulkUnsuspend: "Unsuspended",
+}
+
+// BulkAction is something to do to many cards at once with Bulk
+type BulkAction struct {
+	// Action is one of the Bulk constants
+	Action string
+	// Deck is the deck cards are moved or copied to
+	Deck int
+	// From is the deck cards are moved or removed from
+	From int
+	// Tag is the tag added or removed
+	Tag string
+	// Author is recorded in the revisions of actions that change the cards themselves
+	Author string
+}
+
+// BulkResult summarizes what a Bulk action did
+type BulkResult struct {
+	Action string
+	// Cards is the number of cards the action was applied to and Changed is how many of
+	// them it made a difference to
+	Cards   int
+	Changed int
+}
+
+// Summary describes the result, e.g. "Suspended 3 of 4 cards"
+func (r *BulkResult) Summary() string {
+	s := "s"
+	if r.Cards == 1 {
+		s = ""
+	}
+	if r.Changed == r.Cards {
+		return fmt.Sprintf("%s %d card%s", bulkVerbs[r.Action], r.Cards, s)
+	}
+	return fmt.Sprintf("%s %d of %d card%s, the rest were unchanged", bulkVerbs[r.Action], r.Changed, r.Cards, s)
+}
+
+// CheckBulk returns an error if the action can't be applied: it's unknown, or it's missing
+// the deck or tag it needs
+func (db *Database) CheckBulk(a BulkAction) error {
+	if _, ok := bulkVerbs[a.Action]; !ok {
+		return fmt.Errorf("unknown bulk action %q", a.Action)
+	}
+	if (a.Action == BulkMove || a.Action == BulkCopy) && db.GetDeck(a.Deck) == nil {
+		return fmt.Errorf("no deck with ID %d", a.Deck)
+	}
+	if (a.Action == BulkMove || a.Action == BulkRemove) && a.From == 0 {
+		return fmt.Errorf("%s needs a deck to %s cards from", a.Action, a.Action)
+	}
+	if a.Action == BulkMove && a.From == a.Deck {
+		return fmt.Errorf("can't move cards to the deck they're in")
+	}
+	if (a.Action == BulkTag || a.Action == BulkUntag) && NormalizeTag(a.Tag) == "" {
+		return fmt.Errorf("%s needs a tag", a.Action)
+	}
+	return nil
+}
+
+// Bulk applies the action to the cards in a single transaction, so either all of them are
+// changed or none are. Cards in the trash are left alone. Deleting, resetting and
+// suspending are recorded in each card's revision history.
+func (db *Database) Bulk(cardIDs []int, a BulkAction) (*BulkResult, error) {
+	defer db.observe("Bulk", time.Now())
+	if e := db.CheckBulk(a); e != nil {
+		return nil, e
+	}
+	a.Tag = NormalizeTag(a.Tag)
+
+	tx, e := db.Begin()
+	if e != nil {
+		return nil, e
+	}
+	res := &BulkResult{Action: a.Action, Cards: len(cardIDs)}
+	for _, id := range cardIDs {
+		changed, e := bulkCard(tx, id, a)
+		if e != nil {
+			tx.Rollback()
+			return nil, e
+		}
+		if changed {
+			res.Changed++
+		}
+	}
+	return res, tx.Commit()
+}
+
+// bulkCard applies the action to one card and returns true if it changed anything
+func bulkCard(tx *sql.Tx, cardID int, a BulkAction) (bool, error) {
+	old, e := snapshot(tx, KindCard, cardID)
+	if e != nil || old == nil {
+		return false, e
+	}
+
+	// Actions on the card's fields are recorded as revisions, the others on its decks and
+	// tags just count rows
+	var stmts []string
+	var args [][]interface{}
+	revision := ""
+	switch a.Action {
+	case BulkMove:
+		stmts = []string{`DELETE FROM deck_card WHERE deck_id=? AND card_id=?`,
+			`INSERT OR IGNORE INTO deck_card (deck_id, card_id) VALUES (?, ?)`}
+		args = [][]interface{}{{a.From, cardID}, {a.Deck, cardID}}
+	case BulkCopy:
+		stmts = []string{`INSERT OR IGNORE INTO deck_card (deck_id, card_id) VALUES (?, ?)`}
+		args = [][]interface{}{{a.Deck, cardID}}
+	case BulkRemove:
+		stmts = []string{`DELETE FROM deck_card WHERE deck_id=? AND card_id=?`}
+		args = [][]interface{}{{a.From, cardID}}
+	case BulkTag:
+		stmts = []string{`INSERT OR IGNORE INTO card_tag (card_id, tag) VALUES (?, ?)`}
+		args = [][]interface{}{{cardID, a.Tag}}
+	case BulkUntag:
+		stmts = []string{`DELETE FROM card_tag WHERE card_id=? AND tag=?`}
+		args = [][]interface{}{{cardID, a.Tag}}
+	case BulkDelete:
+		stmts = []string{`UPDATE card SET deleted=? WHERE card_id=?`}
+		args = [][]interface{}{{time.Now().UTC(), cardID}}
+		revision = ActionDelete
+	case BulkReset:
+		stmts = []string{`UPDATE card SET views=0, last_view=?, leech=0 WHERE card_id=?`}
+		args = [][]interface{}{{time.Time{}, cardID}}
+		revision = ActionEdit
+	case BulkSuspend:
+		stmts = []string{`UPDATE card SET suspended=1 WHERE card_id=?`}
+		args = [][]interface{}{{cardID}}
+		revision = ActionEdit
+	case BulkUnsuspend:
+		// The same as SetSuspended
+		stmts = []string{`UPDATE card SET suspended=0, leech=0 WHERE card_id=?`}
+		args = [][]interface{}{{cardID}}
+		revision = ActionEdit
+	}
+
+	var rows int64
+	for i, stmt := range stmts {
+		res, e := tx.Exec(stmt, args[i]...)
+		if e != nil {
+			return false, e
+		}
+		n, e := res.RowsAffected()
+		if e != nil {
+			return false, e
+		}
+		rows += n
+	}
+	if revision == "" {
+		return rows > 0, nil
+	}
+
+	after, e := snapshot(tx, KindCard, cardID)
+	if e != nil || bytes.Equal(old, after) {
+		return false, e
+	}
+	rev := &Revision{Kind: KindCard, ItemID: cardID, Author: a.Author, Action: revision, Old: old, New: after}
+	return true, addRevision(tx, rev)
+}
@@ -0,0 +1,113 @@
+package carddb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBulk(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	from, _ := db.NewDeck("From")
+	to, _ := db.NewDeck("To")
+	var ids []int
+	for i := 0; i < 3; i++ {
+		c, _ := db.NewCard()
+		db.AddCardToDeck(c.ID, from.ID)
+		ids = append(ids, c.ID)
+	}
+	db.AddCardToDeck(ids[2], to.ID)
+
+	bulk := func(a BulkAction, ids ...int) *BulkResult {
+		t.Helper()
+		res, e := db.Bulk(ids, a)
+		if e != nil {
+			t.Fatal(e)
+		}
+		return res
+	}
+	deckSize := func(deckID int) int {
+		t.Helper()
+		cards, e := db.GetCards(deckID)
+		if e != nil {
+			t.Fatal(e)
+		}
+		return len(cards)
+	}
+
+	if res := bulk(BulkAction{Action: BulkCopy, Deck: to.ID}, ids...); res.Changed != 2 || res.Cards != 3 {
+		t.Errorf("got copy: %+v", res)
+	}
+	if res := bulk(BulkAction{Action: BulkMove, Deck: to.ID, From: from.ID}, ids[0]); res.Changed != 1 {
+		t.Errorf("got move: %+v", res)
+	}
+	if deckSize(from.ID) != 2 || deckSize(to.ID) != 3 {
+		t.Errorf("got deck sizes: %d %d", deckSize(from.ID), deckSize(to.ID))
+	}
+	bulk(BulkAction{Action: BulkRemove, From: to.ID}, ids...)
+	if deckSize(to.ID) != 0 {
+		t.Errorf("got %d cards after removing", deckSize(to.ID))
+	}
+
+	bulk(BulkAction{Action: BulkTag, Tag: " Verbs  Irregular "}, ids[0], ids[1])
+	bulk(BulkAction{Action: BulkTag, Tag: "nouns"}, ids[1])
+	bulk(BulkAction{Action: BulkUntag, Tag: "verbs-irregular"}, ids[0])
+	tags, e := db.GetCardTags()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if want := map[int][]string{ids[1]: {"nouns", "verbs-irregular"}}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("got tags: %v want: %v", tags, want)
+	}
+
+	card := db.GetCard(ids[0])
+	card.Views = 5
+	card.Leech = true
+	db.UpdateCard(card)
+	if res := bulk(BulkAction{Action: BulkReset, Author: "me"}, ids...); res.Changed != 1 {
+		t.Errorf("got reset: %+v", res)
+	}
+	if got := db.GetCard(ids[0]); got.Views != 0 || got.Leech {
+		t.Errorf("got reset card: %+v", got)
+	}
+	if revs, _ := db.GetRevisions(KindCard, ids[0]); len(revs) != 1 || revs[0].Author != "me" {
+		t.Errorf("got revisions: %+v", revs)
+	}
+
+	bulk(BulkAction{Action: BulkSuspend}, ids[0], ids[1])
+	if !db.GetCard(ids[1]).Suspended || db.GetCard(ids[2]).Suspended {
+		t.Error("wrong cards suspended")
+	}
+
+	res := bulk(BulkAction{Action: BulkDelete}, ids[0], ids[1])
+	if res.Summary() != "Moved to the trash 2 cards" {
+		t.Errorf("got summary: %q", res.Summary())
+	}
+	if res := bulk(BulkAction{Action: BulkSuspend}, ids...); res.Changed != 1 ||
+		res.Summary() != "Suspended 1 of 3 cards, the rest were unchanged" {
+		t.Errorf("trashed cards changed: %+v", res)
+	}
+
+	// Bad actions change nothing
+	for _, a := range []BulkAction{
+		{Action: "bogus"},
+		{Action: BulkMove, Deck: to.ID},
+		{Action: BulkMove, Deck: from.ID, From: from.ID},
+		{Action: BulkCopy, Deck: 1000},
+		{Action: BulkTag, Tag: " "},
+	} {
+		if _, e := db.Bulk(ids, a); e == nil {
+			t.Errorf("%+v succeeded", a)
+		}
+	}
+	if _, e := db.Bulk([]int{ids[2], 1000}, BulkAction{Action: BulkCopy, Deck: to.ID}); e == nil {
+		t.Error("copied a missing card")
+	}
+	if deckSize(to.ID) != 0 {
+		t.Error("failed bulk action wasn't rolled back")
+	}
+}
@@ -0,0 +1,239 @@
+package carddb
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Kinds of problem found by CheckIntegrity
+const (
+	// ProblemCorrupt is damage to the database file found by SQLite's integrity check.
+	// It can't be fixed here; restore a backup instead.
+	ProblemCorrupt = "corrupt"
+	// ProblemDangling is a row referring to a deck, card or other item that doesn't exist
+	ProblemDangling = "dangling"
+	// ProblemWeight is a deck or preset weight that's negative or missing
+	ProblemWeight = "weight"
+	// ProblemViews is a card with a negative view count
+	ProblemViews = "views"
+	// ProblemLastView is a card last viewed in the future
+	ProblemLastView = "last view"
+)
+
+// Problem is something wrong with the database found by CheckIntegrity
+type Problem struct {
+	Kind string
+	// Table and RowID identify the row with the problem. They're empty for corruption.
+	Table string
+	RowID int64
+	// Description says what's wrong and Fix what fixing it does, or is empty if it can't
+	// be fixed
+	Description string
+	Fix         string
+	Fixed       bool
+
+	// fixSQL and fixArgs are the statement that fixes the problem
+	fixSQL  string
+	fixArgs []interface{}
+}
+
+// CheckIntegrity looks for corruption, rows referring to missing items, invalid weights,
+// negative view counts and last views in the future. With fix it also fixes everything it
+// can in one transaction and marks those problems Fixed.
+func (db *Database) CheckIntegrity(fix bool) ([]*Problem, error) {
+	defer db.observe("CheckIntegrity", time.Now())
+	var problems []*Problem
+	e := db.inTx(func(tx *sql.Tx) error {
+		for _, check := range []func(tx *sql.Tx) ([]*Problem, error){
+			checkCorrupt, checkDangling, checkWeights, checkCards,
+		} {
+			ps, e := check(tx)
+			if e != nil {
+				return e
+			}
+			problems = append(problems, ps...)
+		}
+		if !fix {
+			return nil
+		}
+		for _, p := range problems {
+			if p.fixSQL == "" {
+				continue
+			}
+			if _, e := tx.Exec(p.fixSQL, p.fixArgs...); e != nil {
+				return fmt.Errorf("fixing %s: %v", p.Description, e)
+			}
+		}
+		return nil
+	})
+	if e != nil {
+		return nil, e
+	}
+	if fix {
+		for _, p := range problems {
+			p.Fixed = p.fixSQL != ""
+		}
+	}
+	return problems, nil
+}
+
+func checkCorrupt(tx *sql.Tx) ([]*Problem, error) {
+	rows, e := tx.Query(`PRAGMA integrity_check`)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+	var problems []*Problem
+	for rows.Next() {
+		var msg string
+		if e := rows.Scan(&msg); e != nil {
+			return nil, e
+		}
+		if msg != "ok" {
+			problems = append(problems, &Problem{Kind: ProblemCorrupt, Description: msg})
+		}
+	}
+	return problems, rows.Err()
+}
+
+// checkDangling finds the rows that break their foreign keys. Databases from before the
+// keys were enforced can have them.
+func checkDangling(tx *sql.Tx) ([]*Problem, error) {
+	type violation struct {
+		table, parent string
+		rowID, fkID   int64
+	}
+	rows, e := tx.Query(`PRAGMA foreign_key_check`)
+	if e != nil {
+		return nil, e
+	}
+	var violations []violation
+	for rows.Next() {
+		var v violation
+		if e := rows.Scan(&v.table, &v.rowID, &v.parent, &v.fkID); e != nil {
+			rows.Close()
+			return nil, e
+		}
+		violations = append(violations, v)
+	}
+	rows.Close()
+	if e := rows.Err(); e != nil {
+		return nil, e
+	}
+
+	var problems []*Problem
+	for _, v := range violations {
+		var column string
+		e := tx.QueryRow(`SELECT "from" FROM pragma_foreign_key_list(?) WHERE id=?`, v.table, v.fkID).Scan(&column)
+		if e != nil {
+			return nil, e
+		}
+		var id int64
+		if e := tx.QueryRow(`SELECT `+column+` FROM `+v.table+` WHERE rowid=?`, v.rowID).Scan(&id); e != nil {
+			return nil, e
+		}
+		p := &Problem{
+			Kind:        ProblemDangling,
+			Table:       v.table,
+			RowID:       v.rowID,
+			Description: fmt.Sprintf("%s row %d refers to %s %d, which doesn't exist", v.table, v.rowID, v.parent, id),
+			Fix:         "delete the row",
+			fixSQL:      `DELETE FROM ` + v.table + ` WHERE rowid=?`,
+			fixArgs:     []interface{}{v.rowID},
+		}
+		// A deck without its preset is still a deck
+		if v.table == "deck" {
+			p.Fix = "unlink the " + v.parent
+			p.fixSQL = `UPDATE deck SET ` + column + `=NULL WHERE rowid=?`
+		}
+		problems = append(problems, p)
+	}
+	return problems, nil
+}
+
+// checkWeights finds deck and preset weights that can't be used to pick cards
+func checkWeights(tx *sql.Tx) ([]*Problem, error) {
+	var problems []*Problem
+	for _, table := range []string{"deck", "preset"} {
+		for _, option := range []string{OptionDateWeight, OptionViewWeight} {
+			rows, e := tx.Query(`
+SELECT rowid, name, ` + option + ` FROM ` + table + ` WHERE ` + option + ` IS NULL OR ` + option + ` < 0`)
+			if e != nil {
+				return nil, e
+			}
+			for rows.Next() {
+				var id int64
+				var name string
+				var weight sql.NullFloat64
+				if e := rows.Scan(&id, &name, &weight); e != nil {
+					rows.Close()
+					return nil, e
+				}
+				value := "missing"
+				if weight.Valid {
+					value = fmt.Sprint(weight.Float64)
+				}
+				problems = append(problems, &Problem{
+					Kind:        ProblemWeight,
+					Table:       table,
+					RowID:       id,
+					Description: fmt.Sprintf("%s %d %q has %s %s", table, id, name, option, value),
+					Fix:         "set it to 1",
+					fixSQL:      `UPDATE ` + table + ` SET ` + option + `=1.0 WHERE rowid=?`,
+					fixArgs:     []interface{}{id},
+				})
+			}
+			rows.Close()
+			if e := rows.Err(); e != nil {
+				return nil, e
+			}
+		}
+	}
+	return problems, nil
+}
+
+// checkCards finds cards with negative view counts or last viewed in the future
+func checkCards(tx *sql.Tx) ([]*Problem, error) {
+	now := time.Now().UTC()
+	rows, e := tx.Query(`
+SELECT card_id, views, last_view FROM card
+WHERE views < 0 OR julianday(last_view) > julianday(?)
+ORDER BY card_id`, now)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+	var problems []*Problem
+	for rows.Next() {
+		var id int64
+		var views int
+		var lastView time.Time
+		if e := rows.Scan(&id, &views, &lastView); e != nil {
+			return nil, e
+		}
+		if views < 0 {
+			problems = append(problems, &Problem{
+				Kind:        ProblemViews,
+				Table:       "card",
+				RowID:       id,
+				Description: fmt.Sprintf("card %d has %d views", id, views),
+				Fix:         "set them to 0",
+				fixSQL:      `UPDATE card SET views=0 WHERE card_id=?`,
+				fixArgs:     []interface{}{id},
+			})
+		}
+		if lastView.After(now) {
+			problems = append(problems, &Problem{
+				Kind:        ProblemLastView,
+				Table:       "card",
+				RowID:       id,
+				Description: fmt.Sprintf("card %d was last viewed in the future, at %s", id, lastView.Format(time.RFC3339)),
+				Fix:         "set it to now",
+				fixSQL:      `UPDATE card SET last_view=? WHERE card_id=?`,
+				fixArgs:     []interface{}{now, id},
+			})
+		}
+	}
+	return problems, rows.Err()
+}
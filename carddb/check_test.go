@@ -0,0 +1,135 @@
+package carddb
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, _ := db.NewDeck("Deck")
+	other, _ := db.NewDeck("Other")
+	card, _ := db.NewCard()
+	if e := db.AddCardToDeck(card.ID, deck.ID); e != nil {
+		t.Fatal(e)
+	}
+	preset, _ := db.NewPreset("Preset")
+
+	// Foreign keys stop rows like these being made now, so they're off while making them
+	conn, e := db.Conn(context.Background())
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, stmt := range []string{
+		`PRAGMA foreign_keys = OFF`,
+		`INSERT INTO deck_card (deck_id, card_id) VALUES (1, 999), (999, 1)`,
+		`INSERT INTO card_tag (card_id, tag) VALUES (999, 'gone')`,
+		`UPDATE deck SET preset_id=999 WHERE deck_id=2`,
+		`UPDATE deck SET date_weight=-1 WHERE deck_id=1`,
+		`UPDATE preset SET view_weight=NULL WHERE preset_id=1`,
+		`UPDATE card SET views=-3, last_view='3000-01-01 00:00:00+00:00' WHERE card_id=1`,
+		`PRAGMA foreign_keys = ON`,
+	} {
+		if _, e := conn.ExecContext(context.Background(), stmt); e != nil {
+			t.Fatal(stmt, e)
+		}
+	}
+	conn.Close()
+	if deck.ID != 1 || other.ID != 2 || card.ID != 1 || preset.ID != 1 {
+		t.Fatalf("unexpected IDs: %d %d %d %d", deck.ID, other.ID, card.ID, preset.ID)
+	}
+
+	kinds := func(problems []*Problem) map[string]int {
+		got := make(map[string]int)
+		for _, p := range problems {
+			got[p.Kind]++
+		}
+		return got
+	}
+	problems, e := db.CheckIntegrity(false)
+	if e != nil {
+		t.Fatal(e)
+	}
+	got := kinds(problems)
+	if len(problems) != 8 || got[ProblemDangling] != 4 || got[ProblemWeight] != 2 || got[ProblemViews] != 1 ||
+		got[ProblemLastView] != 1 {
+		t.Errorf("got: %v", got)
+	}
+	for _, p := range problems {
+		if p.Fixed || p.Fix == "" {
+			t.Errorf("unfixed problem: %+v", p)
+		}
+	}
+	if again, _ := db.CheckIntegrity(false); len(again) != len(problems) {
+		t.Errorf("checking fixed %d problems", len(problems)-len(again))
+	}
+
+	if problems, e = db.CheckIntegrity(true); e != nil {
+		t.Fatal(e)
+	}
+	for _, p := range problems {
+		if !p.Fixed {
+			t.Errorf("not fixed: %+v", p)
+		}
+	}
+	if problems, e := db.CheckIntegrity(false); e != nil || len(problems) != 0 {
+		t.Errorf("after fixing got: %v, %v", problems, e)
+	}
+
+	// The deck with the missing preset is kept, and the card is still in its deck
+	if d := db.GetDeck(other.ID); d == nil || d.ViewWeight != 1 {
+		t.Errorf("got deck: %+v", d)
+	}
+	if d := db.GetDeck(deck.ID); d == nil || d.DateWeight != 1 {
+		t.Errorf("got deck: %+v", d)
+	}
+	if p := db.GetPreset(preset.ID); p == nil || p.ViewWeight != 1 {
+		t.Errorf("got preset: %+v", p)
+	}
+	c := db.GetCard(card.ID)
+	if c.Views != 0 || c.LastView.After(time.Now()) {
+		t.Errorf("got card: %+v", c)
+	}
+	if cards, _ := db.GetCards(deck.ID); len(cards) != 1 {
+		t.Errorf("got deck cards: %v", cards)
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, _ := db.NewDeck("Deck")
+	card, _ := db.NewCard()
+	if e := db.AddCardToDeck(card.ID, deck.ID); e != nil {
+		t.Fatal(e)
+	}
+	if e := db.AddCardToDeck(card.ID+1, deck.ID); e == nil {
+		t.Error("added a missing card to a deck")
+	}
+	if e := db.AddReview(&Review{CardID: card.ID, DeckID: deck.ID, Grade: GradeGood}); e != nil {
+		t.Fatal(e)
+	}
+
+	if _, e := db.Exec(`DELETE FROM card WHERE card_id=?`, card.ID); e != nil {
+		t.Fatal(e)
+	}
+	var links int
+	db.QueryRow(`SELECT COUNT(*) FROM deck_card`).Scan(&links)
+	if links != 0 {
+		t.Errorf("%d deck_card rows left for the deleted card", links)
+	}
+	// Reviews stay for stats
+	if reviews, _ := db.GetReviews(card.ID); len(reviews) != 1 {
+		t.Errorf("got reviews of the deleted card: %v", reviews)
+	}
+}
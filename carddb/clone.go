@@ -0,0 +1,106 @@
+package carddb
+
+import (
+	"fmt"
+	"time"
+)
+
+// CloneOptions says what CloneDeck carries over to the new deck
+type CloneOptions struct {
+	Name string
+	// Deep copies the cards instead of sharing them with the original deck. The copies
+	// start with fresh stats unless Stats is set.
+	Deep bool
+	// Preset links the new deck to the original's preset, otherwise it only gets a copy of
+	// the options
+	Preset bool
+	// Stats, Suspended and Tags are for deep clones, copying the cards' views and leech
+	// flags, whether they're suspended and their tags
+	Stats     bool
+	Suspended bool
+	Tags      bool
+	// Cards selects which of the deck's cards are cloned, for example only leeches. Its
+	// Deck, Sort and paging are ignored.
+	Cards CardQuery
+}
+
+// CloneDeck makes a new deck with the options and cards of the deck with the given ID
+func (db *Database) CloneDeck(deckID int, o CloneOptions) (*Deck, error) {
+	defer db.observe("CloneDeck", time.Now())
+	if db.GetDeck(deckID) == nil {
+		return nil, fmt.Errorf("no deck with ID %d", deckID)
+	}
+	if o.Name == "" {
+		return nil, fmt.Errorf("the new deck needs a name")
+	}
+	q := o.Cards
+	q.Deck = deckID
+	q.Sort = SortCreated
+	q.Limit = 0
+	q.Offset = 0
+	page, e := db.QueryCards(q)
+	if e != nil {
+		return nil, e
+	}
+
+	tx, e := db.Begin()
+	if e != nil {
+		return nil, e
+	}
+	res, e := tx.Exec(`
+INSERT INTO deck (name, date_weight, view_weight, view_limit, type_answer, leech_threshold, leech_suspend,
+  preset_id, overrides)
+SELECT ?, date_weight, view_weight, view_limit, type_answer, leech_threshold, leech_suspend,
+  CASE WHEN ? THEN preset_id END, overrides
+FROM deck WHERE deck_id=?`, o.Name, o.Preset, deckID)
+	if e != nil {
+		tx.Rollback()
+		return nil, e
+	}
+	id, e := res.LastInsertId()
+	if e != nil {
+		tx.Rollback()
+		return nil, e
+	}
+
+	for _, c := range page.Cards {
+		cardID := c.ID
+		if o.Deep {
+			if !o.Stats {
+				c.Views, c.LastView, c.Leech = 0, time.Time{}, false
+			}
+			if !o.Suspended {
+				c.Suspended = false
+			}
+			res, e := tx.Exec(`
+INSERT INTO card (front, back, views, last_view, suspended, leech)
+VALUES (?, ?, ?, ?, ?, ?)`, c.Front, c.Back, c.Views, c.LastView.UTC(), c.Suspended, c.Leech)
+			if e != nil {
+				tx.Rollback()
+				return nil, e
+			}
+			newID, e := res.LastInsertId()
+			if e != nil {
+				tx.Rollback()
+				return nil, e
+			}
+			cardID = int(newID)
+			if o.Tags {
+				_, e := tx.Exec(`INSERT INTO card_tag (card_id, tag) SELECT ?, tag FROM card_tag WHERE card_id=?`,
+					cardID, c.ID)
+				if e != nil {
+					tx.Rollback()
+					return nil, e
+				}
+			}
+		}
+		if _, e := tx.Exec(`INSERT INTO deck_card (deck_id, card_id) VALUES (?, ?)`, id, cardID); e != nil {
+			tx.Rollback()
+			return nil, e
+		}
+	}
+	if e := tx.Commit(); e != nil {
+		return nil, e
+	}
+	return db.GetDeck(int(id)), nil
+}
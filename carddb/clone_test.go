@@ -0,0 +1,93 @@
+package carddb
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCloneDeck(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	preset, _ := db.NewPreset("Preset")
+	deck, _ := db.NewDeck("Spanish")
+	deck.ViewLimit = 4
+	db.UpdateDeck(deck)
+	db.SetDeckPreset(deck.ID, preset.ID, []string{OptionViewLimit})
+
+	var ids []int
+	for i, front := range []string{"uno", "dos"} {
+		c, _ := db.NewCard()
+		c.Front = front
+		c.Views = 3
+		c.LastView = time.Now()
+		c.Leech = i == 1
+		c.Suspended = i == 1
+		db.UpdateCard(c)
+		db.AddCardToDeck(c.ID, deck.ID)
+		ids = append(ids, c.ID)
+	}
+	db.Bulk(ids, BulkAction{Action: BulkTag, Tag: "numbers"})
+
+	shallow, e := db.CloneDeck(deck.ID, CloneOptions{Name: "Shared", Preset: true})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if shallow.Name != "Shared" || shallow.ViewLimit != 4 {
+		t.Errorf("got shallow clone: %+v", shallow)
+	}
+	if presetID, overrides, _ := db.GetDeckPreset(shallow.ID); presetID != preset.ID || len(overrides) != 1 {
+		t.Errorf("got clone's preset: %d %v", presetID, overrides)
+	}
+	cards, _ := db.GetCards(shallow.ID)
+	sort.Sort(CardsByID(cards))
+	if len(cards) != 2 || cards[0].ID != ids[0] || cards[1].ID != ids[1] {
+		t.Errorf("got shared cards: %v", cards)
+	}
+
+	deep, e := db.CloneDeck(deck.ID, CloneOptions{Name: "Copy", Deep: true, Tags: true})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if presetID, _, _ := db.GetDeckPreset(deep.ID); presetID != 0 {
+		t.Errorf("deep clone linked to preset %d", presetID)
+	}
+	cards, _ = db.GetCards(deep.ID)
+	if len(cards) != 2 {
+		t.Fatalf("got %d copied cards", len(cards))
+	}
+	tags, _ := db.GetCardTags()
+	for _, c := range cards {
+		if c.ID == ids[0] || c.ID == ids[1] || c.Views != 0 || c.Leech || c.Suspended || !c.LastView.IsZero() {
+			t.Errorf("got copied card: %+v", c)
+		}
+		if !reflect.DeepEqual(tags[c.ID], []string{"numbers"}) {
+			t.Errorf("got copied tags: %v", tags[c.ID])
+		}
+	}
+
+	leeches, e := db.CloneDeck(deck.ID, CloneOptions{Name: "Hard", Deep: true, Stats: true, Suspended: true,
+		Cards: CardQuery{Leech: true}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	cards, _ = db.GetCards(leeches.ID)
+	if len(cards) != 1 || cards[0].Front != "dos" || cards[0].Views != 3 || !cards[0].Leech || !cards[0].Suspended {
+		t.Errorf("got leeches: %+v", cards)
+	}
+	if tags, _ := db.GetCardTags(); tags[cards[0].ID] != nil {
+		t.Errorf("tags copied: %v", tags[cards[0].ID])
+	}
+
+	if _, e := db.CloneDeck(deck.ID, CloneOptions{}); e == nil {
+		t.Error("cloned without a name")
+	}
+	if _, e := db.CloneDeck(1000, CloneOptions{Name: "Missing"}); e == nil {
+		t.Error("cloned a missing deck")
+	}
+}
@@ -1,7 +1,12 @@
 package carddb
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/Bredgren/wrand"
@@ -30,6 +35,7 @@ CREATE TABLE IF NOT EXISTS card (
   last_view DATETIME DEFAULT (DATETIME('0001-01-01 00:00:00'))
 );
 
+-- Migration 11 adds ON DELETE CASCADE to the foreign keys
 CREATE TABLE IF NOT EXISTS deck_card (
   deck_id INTEGER FOREIGN_KEY REFERENCES deck(deck_id),
   card_id INTEGER FOREIGN_KEY REFERENCES card(card_id),
@@ -39,21 +45,354 @@ CREATE TABLE IF NOT EXISTS deck_card (
 `
 )
 
+// migrations upgrade the schema one version at a time. migrations[i] takes a database from
+// version i+1 to i+2, version 1 being the tables created by schema. Each runs in its own
+// transaction with foreign keys off. Append to the end when changing the schema.
+var migrations = []string{
+	// 2: Typed answers and review history
+	`
+ALTER TABLE deck ADD COLUMN type_answer INTEGER DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS review (
+  review_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  card_id INTEGER REFERENCES card(card_id),
+  deck_id INTEGER REFERENCES deck(deck_id),
+  -- Datetime in UTC
+  time DATETIME NOT NULL,
+  grade TEXT NOT NULL,
+  -- What was typed, for decks with type_answer
+  answer TEXT DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS review_card ON review(card_id);
+`,
+	// 3: Multiple choice quiz results
+	`
+CREATE TABLE IF NOT EXISTS quiz (
+  quiz_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  deck_id INTEGER REFERENCES deck(deck_id),
+  -- Datetime in UTC
+  time DATETIME NOT NULL,
+  correct INTEGER NOT NULL,
+  total INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS quiz_deck ON quiz(deck_id);
+
+-- The card's front and back are copied so results survive the card changing
+CREATE TABLE IF NOT EXISTS quiz_answer (
+  quiz_id INTEGER REFERENCES quiz(quiz_id),
+  card_id INTEGER,
+  front TEXT NOT NULL,
+  back TEXT NOT NULL,
+  chosen TEXT NOT NULL,
+  correct INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS quiz_answer_quiz ON quiz_answer(quiz_id);
+`,
+	// 4: Timed exams
+	`
+CREATE TABLE IF NOT EXISTS exam (
+  exam_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  -- Names of the decks the cards were drawn from
+  decks TEXT NOT NULL,
+  -- Datetimes in UTC, finished is NULL until the answers are in
+  started DATETIME NOT NULL,
+  finished DATETIME,
+  -- In seconds
+  time_limit INTEGER NOT NULL
+);
+
+-- The card's front and back are copied so reports survive the card changing
+CREATE TABLE IF NOT EXISTS exam_card (
+  exam_id INTEGER REFERENCES exam(exam_id),
+  position INTEGER NOT NULL,
+  card_id INTEGER,
+  front TEXT NOT NULL,
+  back TEXT NOT NULL,
+  answer TEXT DEFAULT '',
+  correct INTEGER DEFAULT 0,
+  PRIMARY KEY (exam_id, position)
+);
+`,
+	// 5: Answer times
+	`
+-- Milliseconds taken to answer, 0 if unknown
+ALTER TABLE review ADD COLUMN duration INTEGER DEFAULT 0;
+`,
+	// 6: Leeches and suspended cards
+	`
+ALTER TABLE deck ADD COLUMN leech_threshold INTEGER DEFAULT 8;
+ALTER TABLE deck ADD COLUMN leech_suspend INTEGER DEFAULT 0;
+ALTER TABLE card ADD COLUMN suspended INTEGER DEFAULT 0;
+ALTER TABLE card ADD COLUMN leech INTEGER DEFAULT 0;
+`,
+	// 7: Trash. Deleted decks and cards keep their deck_card rows so they can be restored.
+	`
+-- Datetime in UTC the item was moved to the trash, NULL if it's not in the trash
+ALTER TABLE deck ADD COLUMN deleted DATETIME;
+ALTER TABLE card ADD COLUMN deleted DATETIME;
+`,
+	// 8: Revision history of card and deck changes
+	`
+CREATE TABLE IF NOT EXISTS revision (
+  revision_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  -- 'card' or 'deck'
+  kind TEXT NOT NULL,
+  item_id INTEGER NOT NULL,
+  -- Datetime in UTC
+  time DATETIME NOT NULL,
+  author TEXT DEFAULT '',
+  action TEXT NOT NULL,
+  -- The item's fields as JSON before and after, NULL when it was in the trash
+  old TEXT,
+  new TEXT,
+  -- The review logged by a grade, deleted when the grade is reverted
+  review_id INTEGER,
+  -- The revision a revert reverted
+  reverts INTEGER
+);
+CREATE INDEX IF NOT EXISTS revision_item ON revision(kind, item_id);
+`,
+	// 9: Card tags
+	`
+CREATE TABLE IF NOT EXISTS card_tag (
+  card_id INTEGER REFERENCES card(card_id),
+  tag TEXT NOT NULL,
+  PRIMARY KEY (card_id, tag)
+);
+CREATE INDEX IF NOT EXISTS card_tag_tag ON card_tag(tag);
+`,
+	// 10: Deck option presets. A preset's options are copied to its decks, except those a
+	// deck overrides, so everything reading decks can keep using their own columns.
+	`
+CREATE TABLE IF NOT EXISTS preset (
+  preset_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL,
+  -- The same options with the same defaults as deck
+  date_weight FLOAT DEFAULT 1.0,
+  view_weight FLOAT DEFAULT 1.0,
+  view_limit INTEGER DEFAULT 1,
+  type_answer INTEGER DEFAULT 0,
+  leech_threshold INTEGER DEFAULT 8,
+  leech_suspend INTEGER DEFAULT 0
+);
+
+ALTER TABLE deck ADD COLUMN preset_id INTEGER REFERENCES preset(preset_id);
+-- Comma separated names of the option columns the deck sets itself
+ALTER TABLE deck ADD COLUMN overrides TEXT DEFAULT '';
+`,
+	// 11: Foreign keys that delete rows along with the items they belong to. SQLite can't add
+	// constraints to a table so the tables are rebuilt, which migrate does with foreign keys
+	// off. Rows that already point at missing items are kept for CheckIntegrity to find.
+	// Reviews and quizzes keep the IDs of purged cards and decks so they still count in
+	// stats, so those columns aren't constrained.
+	`
+CREATE TABLE deck_card_new (
+  deck_id INTEGER REFERENCES deck(deck_id) ON DELETE CASCADE,
+  card_id INTEGER REFERENCES card(card_id) ON DELETE CASCADE,
+  -- A card cannot be in the same deck more than once, though it can be in more than one deck
+  UNIQUE(deck_id, card_id)
+);
+INSERT INTO deck_card_new SELECT deck_id, card_id FROM deck_card;
+DROP TABLE deck_card;
+ALTER TABLE deck_card_new RENAME TO deck_card;
+CREATE INDEX deck_card_card ON deck_card(card_id);
+
+CREATE TABLE review_new (
+  review_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  card_id INTEGER,
+  deck_id INTEGER,
+  -- Datetime in UTC
+  time DATETIME NOT NULL,
+  grade TEXT NOT NULL,
+  -- What was typed, for decks with type_answer
+  answer TEXT DEFAULT '',
+  -- Milliseconds taken to answer, 0 if unknown
+  duration INTEGER DEFAULT 0
+);
+INSERT INTO review_new SELECT review_id, card_id, deck_id, time, grade, answer, duration FROM review;
+-- Keep the IDs of deleted reviews from being reused, revisions refer to them
+DELETE FROM sqlite_sequence WHERE name='review_new';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'review_new', seq FROM sqlite_sequence WHERE name='review';
+DROP TABLE review;
+ALTER TABLE review_new RENAME TO review;
+CREATE INDEX review_card ON review(card_id);
+
+CREATE TABLE quiz_new (
+  quiz_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  deck_id INTEGER,
+  -- Datetime in UTC
+  time DATETIME NOT NULL,
+  correct INTEGER NOT NULL,
+  total INTEGER NOT NULL
+);
+INSERT INTO quiz_new SELECT quiz_id, deck_id, time, correct, total FROM quiz;
+DELETE FROM sqlite_sequence WHERE name='quiz_new';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'quiz_new', seq FROM sqlite_sequence WHERE name='quiz';
+DROP TABLE quiz;
+ALTER TABLE quiz_new RENAME TO quiz;
+CREATE INDEX quiz_deck ON quiz(deck_id);
+
+-- The card's front and back are copied so results survive the card changing
+CREATE TABLE quiz_answer_new (
+  quiz_id INTEGER REFERENCES quiz(quiz_id) ON DELETE CASCADE,
+  card_id INTEGER,
+  front TEXT NOT NULL,
+  back TEXT NOT NULL,
+  chosen TEXT NOT NULL,
+  correct INTEGER NOT NULL
+);
+INSERT INTO quiz_answer_new SELECT quiz_id, card_id, front, back, chosen, correct FROM quiz_answer;
+DROP TABLE quiz_answer;
+ALTER TABLE quiz_answer_new RENAME TO quiz_answer;
+CREATE INDEX quiz_answer_quiz ON quiz_answer(quiz_id);
+
+-- The card's front and back are copied so reports survive the card changing
+CREATE TABLE exam_card_new (
+  exam_id INTEGER REFERENCES exam(exam_id) ON DELETE CASCADE,
+  position INTEGER NOT NULL,
+  card_id INTEGER,
+  front TEXT NOT NULL,
+  back TEXT NOT NULL,
+  answer TEXT DEFAULT '',
+  correct INTEGER DEFAULT 0,
+  PRIMARY KEY (exam_id, position)
+);
+INSERT INTO exam_card_new SELECT exam_id, position, card_id, front, back, answer, correct FROM exam_card;
+DROP TABLE exam_card;
+ALTER TABLE exam_card_new RENAME TO exam_card;
+
+CREATE TABLE card_tag_new (
+  card_id INTEGER REFERENCES card(card_id) ON DELETE CASCADE,
+  tag TEXT NOT NULL,
+  PRIMARY KEY (card_id, tag)
+);
+INSERT INTO card_tag_new SELECT card_id, tag FROM card_tag;
+DROP TABLE card_tag;
+ALTER TABLE card_tag_new RENAME TO card_tag;
+CREATE INDEX card_tag_tag ON card_tag(tag);
+`,
+	// 12: Reviews deleted by reverts, so reverting the revert can put them back
+	`
+-- The review a revert deleted, as JSON
+ALTER TABLE revision ADD COLUMN deleted_review TEXT;
+`,
+}
+
+// SchemaVersion is the schema version of databases opened by this package
+var SchemaVersion = len(migrations) + 1
+
 // Database hols the sql.DB and other relavent items
 type Database struct {
 	*sql.DB
+
+	fileName string
+
+	// ObserveQuery, if set, is called after each Database operation with the name of the
+	// method and how long it took. It's intended for collecting metrics.
+	ObserveQuery func(op string, d time.Duration)
 }
 
 // OpenDatabase creates and initializes a Database from the given file
 func OpenDatabase(fileName string) (*Database, error) {
-	db, e := sql.Open("sqlite3", fileName)
+	// Foreign keys are enforced per connection, so they're turned on in the DSN that each
+	// connection is opened with
+	dsn := fileName + "?_foreign_keys=1"
+	if strings.Contains(fileName, "?") {
+		dsn = fileName + "&_foreign_keys=1"
+	}
+	db, e := sql.Open("sqlite3", dsn)
 	if e != nil {
 		return nil, e
 	}
 
-	_, e = db.Exec(schema)
+	if _, e = db.Exec(schema); e != nil {
+		return nil, e
+	}
+
+	d := &Database{DB: db, fileName: fileName}
+	return d, d.migrate()
+}
+
+// migrate brings the schema up to SchemaVersion
+func (db *Database) migrate() error {
+	version, e := db.SchemaVersion()
+	if e != nil {
+		return e
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("database schema version %d is newer than supported version %d",
+			version, SchemaVersion)
+	}
+	if version < 1 {
+		version = 1
+	}
+
+	if version == SchemaVersion {
+		return nil
+	}
+
+	// Foreign keys are off so tables can be rebuilt. It has to be set outside a transaction
+	// and only applies to one connection.
+	ctx := context.Background()
+	conn, e := db.Conn(ctx)
+	if e != nil {
+		return e
+	}
+	defer conn.Close()
+	if _, e := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); e != nil {
+		return e
+	}
+	defer conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+
+	// Each migration is committed with its version so a failure can be retried from there
+	for ; version < SchemaVersion; version++ {
+		tx, e := conn.BeginTx(ctx, nil)
+		if e != nil {
+			return e
+		}
+		if _, e := tx.Exec(migrations[version-1]); e != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrating schema to version %d: %v", version+1, e)
+		}
+		if _, e := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); e != nil {
+			tx.Rollback()
+			return e
+		}
+		if e := tx.Commit(); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the schema version stored in the database
+func (db *Database) SchemaVersion() (int, error) {
+	var version int
+	e := db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	return version, e
+}
+
+// CheckWritable returns an error if the database file or the directory it's in, where
+// SQLite creates its journal, can't be written to. In-memory databases are always
+// writable.
+func (db *Database) CheckWritable() error {
+	fileName, _, _ := strings.Cut(db.fileName, "?")
+	if fileName == "" || fileName == ":memory:" || strings.HasPrefix(fileName, "file:") {
+		return nil
+	}
+
+	f, e := os.OpenFile(fileName, os.O_WRONLY, 0)
+	if e != nil {
+		return e
+	}
+	f.Close()
 
-	return &Database{db}, e
+	tmp, e := os.CreateTemp(filepath.Dir(fileName), ".carddb-check-*")
+	if e != nil {
+		return e
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
 }
 
 // Deck represents a deck of cards
@@ -63,6 +402,13 @@ type Deck struct {
 	DateWeight float64
 	ViewWeight float64
 	ViewLimit  int
+	// TypeAnswer makes studying ask for the back to be typed instead of just shown
+	TypeAnswer bool
+	// LeechThreshold is the number of failures in this deck after which a card is flagged
+	// as a leech, 0 to never flag cards
+	LeechThreshold int
+	// LeechSuspend suspends cards when they're flagged as leeches
+	LeechSuspend bool
 }
 
 // Card represents a card in a deck
@@ -72,10 +418,15 @@ type Card struct {
 	Back     string
 	Views    int
 	LastView time.Time
+	// Suspended cards are never picked for study but are still listed
+	Suspended bool
+	// Leech is set when a card has been failed too many times in a deck
+	Leech bool
 }
 
 // NewDeck creates a new deck with the given name with default settings
 func (db *Database) NewDeck(name string) (*Deck, error) {
+	defer db.observe("NewDeck", time.Now())
 	res, e := db.Exec(`INSERT INTO deck (name) VALUES (?)`, name)
 	if e != nil {
 		return nil, e
@@ -87,56 +438,51 @@ func (db *Database) NewDeck(name string) (*Deck, error) {
 	}
 
 	row := db.QueryRow(`
-SELECT deck_id, name, date_weight, view_weight, view_limit
+SELECT deck_id, name, date_weight, view_weight, view_limit, type_answer, leech_threshold, leech_suspend
 FROM deck WHERE deck_id=?`, id)
 	deck := &Deck{}
-	e = row.Scan(&deck.ID, &deck.Name, &deck.DateWeight, &deck.ViewWeight, &deck.ViewLimit)
+	e = row.Scan(&deck.ID, &deck.Name, &deck.DateWeight, &deck.ViewWeight, &deck.ViewLimit, &deck.TypeAnswer,
+		&deck.LeechThreshold, &deck.LeechSuspend)
 	return deck, e
 }
 
 // UpdateDeck updates the given deck in the database to match its fields
 func (db *Database) UpdateDeck(deck *Deck) error {
-	_, e := db.Exec(`
-UPDATE deck
-SET name=?, date_weight=?, view_weight=?, view_limit=?
-WHERE deck_id=?`, deck.Name, deck.DateWeight, deck.ViewWeight, deck.ViewLimit, deck.ID)
-	return e
+	defer db.observe("UpdateDeck", time.Now())
+	return updateDeck(db, deck)
 }
 
-// DelDeck deletes the deck with the given ID
-func (db *Database) DelDeck(deckID int) error {
-	tx, e := db.Begin()
-	if e != nil {
-		return e
-	}
-
-	_, e = db.Exec(`
-DELETE FROM deck
-WHERE deck_id=?`, deckID)
-	if e != nil {
-		tx.Rollback()
-		return e
-	}
-
-	_, e = db.Exec(`
-DELETE FROM deck_card
-WHERE deck_id=?`, deckID)
+func updateDeck(ex execer, deck *Deck) error {
+	_, e := ex.Exec(`
+UPDATE deck
+SET name=?, date_weight=?, view_weight=?, view_limit=?, type_answer=?, leech_threshold=?, leech_suspend=?
+WHERE deck_id=?`, deck.Name, deck.DateWeight, deck.ViewWeight, deck.ViewLimit, deck.TypeAnswer,
+		deck.LeechThreshold, deck.LeechSuspend, deck.ID)
 	if e != nil {
-		tx.Rollback()
 		return e
 	}
+	// The deck's preset, if it has one, takes precedence
+	return applyPreset(ex, `deck_id=?`, deck.ID)
+}
 
-	e = tx.Commit()
+// DelDeck moves the deck with the given ID to the trash. Its cards stay where they are.
+func (db *Database) DelDeck(deckID int) error {
+	defer db.observe("DelDeck", time.Now())
+	_, e := db.Exec(`
+UPDATE deck
+SET deleted=?
+WHERE deck_id=? AND deleted IS NULL`, time.Now().UTC(), deckID)
 	return e
 }
 
 // GetDeck returns the deck with the given ID, or nil if there is no such deck
 func (db *Database) GetDeck(deckID int) *Deck {
+	defer db.observe("GetDeck", time.Now())
 	row := db.QueryRow(`
-SELECT deck_id, name, date_weight, view_weight, view_limit
-FROM deck WHERE deck_id=?`, deckID)
+SELECT deck_id, name, date_weight, view_weight, view_limit, type_answer, leech_threshold, leech_suspend
+FROM deck WHERE deck_id=? AND deleted IS NULL`, deckID)
 	d := &Deck{}
-	e := row.Scan(&d.ID, &d.Name, &d.DateWeight, &d.ViewWeight, &d.ViewLimit)
+	e := row.Scan(&d.ID, &d.Name, &d.DateWeight, &d.ViewWeight, &d.ViewLimit, &d.TypeAnswer, &d.LeechThreshold, &d.LeechSuspend)
 	if e != nil {
 		return nil
 	}
@@ -146,32 +492,36 @@ FROM deck WHERE deck_id=?`, deckID)
 // GetDecks returns all decks that contain the given card. cardID = 0 returns all decks
 // that contain no cards. deckID < 0 returns all decks.
 func (db *Database) GetDecks(cardID int) ([]*Deck, error) {
+	defer db.observe("GetDecks", time.Now())
 	var rows *sql.Rows
 	var e error
 	if cardID < 0 {
 		rows, e = db.Query(`
-SELECT deck_id, name, date_weight, view_weight, view_limit
-FROM deck`)
+SELECT deck_id, name, date_weight, view_weight, view_limit, type_answer, leech_threshold, leech_suspend
+FROM deck
+WHERE deleted IS NULL`)
 	} else if cardID == 0 {
 		rows, e = db.Query(`
-SELECT deck_id, name, date_weight, view_weight, view_limit
+SELECT deck_id, name, date_weight, view_weight, view_limit, type_answer, leech_threshold, leech_suspend
 FROM deck
-WHERE deck_id NOT IN (
+WHERE deleted IS NULL AND deck_id NOT IN (
   SELECT DISTINCT deck_id
   FROM deck_card
+  JOIN card USING (card_id)
+  WHERE card.deleted IS NULL
 )`)
 	} else {
 		rows, e = db.Query(`
-SELECT deck_id, name, date_weight, view_weight, view_limit
+SELECT deck_id, name, date_weight, view_weight, view_limit, type_answer, leech_threshold, leech_suspend
 FROM deck
-NATURAL JOIN deck_card
-WHERE card_id=?`, cardID)
+JOIN deck_card USING (deck_id)
+WHERE card_id=? AND deleted IS NULL`, cardID)
 	}
 	defer rows.Close()
 	var ds []*Deck
 	for rows.Next() {
 		d := &Deck{}
-		if e = rows.Scan(&d.ID, &d.Name, &d.DateWeight, &d.ViewWeight, &d.ViewLimit); e != nil {
+		if e = rows.Scan(&d.ID, &d.Name, &d.DateWeight, &d.ViewWeight, &d.ViewLimit, &d.TypeAnswer, &d.LeechThreshold, &d.LeechSuspend); e != nil {
 			return nil, e
 		}
 		ds = append(ds, d)
@@ -181,6 +531,7 @@ WHERE card_id=?`, cardID)
 
 // NewCard creates a new card with default values
 func (db *Database) NewCard() (*Card, error) {
+	defer db.observe("NewCard", time.Now())
 	res, e := db.Exec(`INSERT INTO card DEFAULT VALUES`)
 	if e != nil {
 		return nil, e
@@ -192,56 +543,46 @@ func (db *Database) NewCard() (*Card, error) {
 	}
 
 	row := db.QueryRow(`
-SELECT card_id, front, back, views, last_view
+SELECT card_id, front, back, views, last_view, suspended, leech
 FROM card WHERE card_id=?`, id)
 	c := &Card{}
-	e = row.Scan(&c.ID, &c.Front, &c.Back, &c.Views, &c.LastView)
+	e = row.Scan(&c.ID, &c.Front, &c.Back, &c.Views, &c.LastView, &c.Suspended, &c.Leech)
 	c.LastView = c.LastView.Local()
 	return c, e
 }
 
 // UpdateCard updates the given card in the database to match its fields
 func (db *Database) UpdateCard(card *Card) error {
-	_, e := db.Exec(`
+	defer db.observe("UpdateCard", time.Now())
+	return updateCard(db, card)
+}
+
+func updateCard(ex execer, card *Card) error {
+	_, e := ex.Exec(`
 UPDATE card
-SET front=?, back=?, views=?, last_view=?
-WHERE card_id=?`, card.Front, card.Back, card.Views, card.LastView.UTC(), card.ID)
+SET front=?, back=?, views=?, last_view=?, suspended=?, leech=?
+WHERE card_id=?`, card.Front, card.Back, card.Views, card.LastView.UTC(), card.Suspended, card.Leech, card.ID)
 	return e
 }
 
-// DelCard deletes the card with the given ID
+// DelCard moves the card with the given ID to the trash
 func (db *Database) DelCard(cardID int) error {
-	tx, e := db.Begin()
-	if e != nil {
-		return e
-	}
-
-	_, e = db.Exec(`
-DELETE FROM card
-WHERE card_id=?`, cardID)
-	if e != nil {
-		tx.Rollback()
-		return e
-	}
-	_, e = db.Exec(`
-DELETE FROM deck_card
-WHERE card_id=?`, cardID)
-	if e != nil {
-		tx.Rollback()
-		return e
-	}
-
-	e = tx.Commit()
+	defer db.observe("DelCard", time.Now())
+	_, e := db.Exec(`
+UPDATE card
+SET deleted=?
+WHERE card_id=? AND deleted IS NULL`, time.Now().UTC(), cardID)
 	return e
 }
 
 // GetCard returns the card with the given ID, or nil if there is no such card
 func (db *Database) GetCard(cardID int) *Card {
+	defer db.observe("GetCard", time.Now())
 	row := db.QueryRow(`
-SELECT card_id, front, back, views, last_view
-FROM card WHERE card_id=?`, cardID)
+SELECT card_id, front, back, views, last_view, suspended, leech
+FROM card WHERE card_id=? AND deleted IS NULL`, cardID)
 	c := &Card{}
-	if e := row.Scan(&c.ID, &c.Front, &c.Back, &c.Views, &c.LastView); e != nil {
+	if e := row.Scan(&c.ID, &c.Front, &c.Back, &c.Views, &c.LastView, &c.Suspended, &c.Leech); e != nil {
 		return nil
 	}
 	c.LastView = c.LastView.Local()
@@ -251,32 +592,36 @@ FROM card WHERE card_id=?`, cardID)
 // GetCards returns all cards in the given deck. deckID = 0 returns all cards that belong
 // to no deck. deckID < 0 returns all cards.
 func (db *Database) GetCards(deckID int) ([]*Card, error) {
+	defer db.observe("GetCards", time.Now())
 	var rows *sql.Rows
 	var e error
 	if deckID < 0 {
 		rows, e = db.Query(`
-SELECT card_id, front, back, views, last_view
-FROM card`)
+SELECT card_id, front, back, views, last_view, suspended, leech
+FROM card
+WHERE deleted IS NULL`)
 	} else if deckID == 0 {
 		rows, e = db.Query(`
-SELECT card_id, front, back, views, last_view
+SELECT card_id, front, back, views, last_view, suspended, leech
 FROM card
-WHERE card_id NOT IN (
+WHERE deleted IS NULL AND card_id NOT IN (
   SELECT DISTINCT card_id
   FROM deck_card
+  JOIN deck USING (deck_id)
+  WHERE deck.deleted IS NULL
 )`)
 	} else {
 		rows, e = db.Query(`
-SELECT card_id, front, back, views, last_view
+SELECT card_id, front, back, views, last_view, suspended, leech
 FROM card
-NATURAL JOIN deck_card
-WHERE deck_id=?`, deckID)
+JOIN deck_card USING (card_id)
+WHERE deck_id=? AND deleted IS NULL`, deckID)
 	}
 	defer rows.Close()
 	var cs []*Card
 	for rows.Next() {
 		c := &Card{}
-		if e = rows.Scan(&c.ID, &c.Front, &c.Back, &c.Views, &c.LastView); e != nil {
+		if e = rows.Scan(&c.ID, &c.Front, &c.Back, &c.Views, &c.LastView, &c.Suspended, &c.Leech); e != nil {
 			return nil, e
 		}
 		c.LastView = c.LastView.Local()
@@ -287,6 +632,7 @@ WHERE deck_id=?`, deckID)
 
 // AddCardToDeck adds the card with the given cardID to the deck with the given deckID
 func (db *Database) AddCardToDeck(cardID, deckID int) error {
+	defer db.observe("AddCardToDeck", time.Now())
 	_, e := db.Exec(`
 INSERT INTO deck_card (deck_id, card_id)
 VALUES (?, ?)`, deckID, cardID)
@@ -295,6 +641,7 @@ VALUES (?, ?)`, deckID, cardID)
 
 // DelCardFromDeck removes the card with the given cardID from the deck with the given deckID
 func (db *Database) DelCardFromDeck(cardID, deckID int) error {
+	defer db.observe("DelCardFromDeck", time.Now())
 	_, e := db.Exec(`
 DELETE FROM deck_card
 WHERE deck_id=? AND card_id=?`, deckID, cardID)
@@ -309,10 +656,27 @@ func (db *Database) ViewCard(card *Card) error {
 	return db.UpdateCard(card)
 }
 
+// StudyCard picks the next card to study from the deck with RandomCard and logs a view
+// of it with ViewCard. It also returns the card as it was before the view, for undoing
+// it. It returns nil if the deck has no cards to study.
+func (db *Database) StudyCard(deck *Deck) (*Card, *Card, error) {
+	cards, e := db.GetCards(deck.ID)
+	if e != nil {
+		return nil, nil, e
+	}
+	card := RandomCard(deck, cards)
+	if card == nil {
+		return nil, nil, nil
+	}
+	before := *card
+	return card, &before, db.ViewCard(card)
+}
+
 // RandomCard return a random card from the deck. The probability of selection depends
-// on the card's view count, last view time, and the decks weights for these. If the deck
-// is empty it will return nil.
+// on the card's view count, last view time, and the decks weights for these. Suspended
+// cards are skipped. If the deck is empty it will return nil.
 func RandomCard(deck *Deck, cards []*Card) *Card {
+	cards = Studyable(cards)
 	if len(cards) == 0 {
 		return nil
 	}
@@ -367,3 +731,11 @@ func (c CardsByID) Less(i, j int) bool {
 func (c CardsByID) Swap(i, j int) {
 	c[i], c[j] = c[j], c[i]
 }
+
+// observe reports the duration of the operation op started at start to ObserveQuery.
+// Use as: defer db.observe("Op", time.Now())
+func (db *Database) observe(op string, start time.Time) {
+	if db.ObserveQuery != nil {
+		db.ObserveQuery(op, time.Since(start))
+	}
+}
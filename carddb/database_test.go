@@ -2,6 +2,7 @@ package carddb
 
 import (
 	"database/sql"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -10,9 +11,19 @@ const testDB = "test.db"
 
 func init() {
 	schema = `
-DROP TABLE IF EXISTS deck;
-DROP TABLE IF EXISTS card;
+PRAGMA user_version = 0;
+-- Tables go before the ones they reference
 DROP TABLE IF EXISTS deck_card;
+DROP TABLE IF EXISTS review;
+DROP TABLE IF EXISTS quiz_answer;
+DROP TABLE IF EXISTS quiz;
+DROP TABLE IF EXISTS exam_card;
+DROP TABLE IF EXISTS exam;
+DROP TABLE IF EXISTS revision;
+DROP TABLE IF EXISTS card_tag;
+DROP TABLE IF EXISTS card;
+DROP TABLE IF EXISTS deck;
+DROP TABLE IF EXISTS preset;
 ` + schema
 }
 
@@ -42,6 +53,8 @@ func TestNewDeck(t *testing.T) {
 		DateWeight: 1.0,
 		ViewWeight: 1.0,
 		ViewLimit:  1,
+
+		LeechThreshold: DefaultLeechThreshold,
 	}
 	got, e := db.NewDeck(want.Name)
 	if e != nil {
@@ -103,10 +116,15 @@ func TestDelDeck(t *testing.T) {
 		t.Fatal(e)
 	}
 
-	row := db.QueryRow(`SELECT deck_id FROM deck WHERE deck_id=?`, deck.ID)
-	var id int
-	if e = row.Scan(&id); e != sql.ErrNoRows {
-		t.Errorf("got: %v want: %v", e, sql.ErrNoRows)
+	if got := db.GetDeck(deck.ID); got != nil {
+		t.Errorf("got: %v want: nil", got)
+	}
+
+	// Kept in the trash
+	row := db.QueryRow(`SELECT deleted FROM deck WHERE deck_id=?`, deck.ID)
+	var deleted sql.NullTime
+	if e = row.Scan(&deleted); e != nil || !deleted.Valid {
+		t.Errorf("got: %v, %v want: deleted time", deleted, e)
 	}
 }
 
@@ -241,10 +259,15 @@ func TestDelCard(t *testing.T) {
 		t.Fatal(e)
 	}
 
-	row := db.QueryRow(`SELECT card_id FROM card WHERE card_id=?`, card.ID)
-	var id int
-	if e = row.Scan(&id); e != sql.ErrNoRows {
-		t.Errorf("got: %v want: %v", e, sql.ErrNoRows)
+	if got := db.GetCard(card.ID); got != nil {
+		t.Errorf("got: %v want: nil", got)
+	}
+
+	// Kept in the trash
+	row := db.QueryRow(`SELECT deleted FROM card WHERE card_id=?`, card.ID)
+	var deleted sql.NullTime
+	if e = row.Scan(&deleted); e != nil || !deleted.Valid {
+		t.Errorf("got: %v, %v want: deleted time", deleted, e)
 	}
 }
 
@@ -415,3 +438,141 @@ func TestLastView(t *testing.T) {
 		t.Errorf("got: %#v, wanted: %#v", got.LastView, c.LastView)
 	}
 }
+
+func TestObserveQuery(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	var ops []string
+	db.ObserveQuery = func(op string, d time.Duration) {
+		ops = append(ops, op)
+	}
+
+	if _, e := db.NewDeck("DeckName"); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := db.GetDecks(-1); e != nil {
+		t.Fatal(e)
+	}
+
+	if len(ops) != 2 || ops[0] != "NewDeck" || ops[1] != "GetDecks" {
+		t.Errorf("got: %v want: [NewDeck GetDecks]", ops)
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	got, e := db.SchemaVersion()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got != SchemaVersion {
+		t.Errorf("got: %d want: %d", got, SchemaVersion)
+	}
+
+	if _, e := db.Exec(`PRAGMA user_version = 1000`); e != nil {
+		t.Fatal(e)
+	}
+	db.Close()
+
+	// Open without the test's schema reset so the version is kept
+	d, e := sql.Open("sqlite3", testDB)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer d.Close()
+	db = &Database{DB: d}
+	if e := db.migrate(); e == nil {
+		t.Error("opening a database with a newer schema succeeded")
+	}
+}
+
+func TestFailedMigration(t *testing.T) {
+	defer func(m []string, v int) { migrations, SchemaVersion = m, v }(migrations, SchemaVersion)
+	migrations = append(migrations[:len(migrations):len(migrations)],
+		`ALTER TABLE card ADD COLUMN extra INTEGER; SELECT missing FROM card`)
+	SchemaVersion++
+
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e == nil {
+		t.Fatal("failing migration succeeded")
+	}
+	// The migrations before it are kept and none of it is
+	if got, _ := db.SchemaVersion(); got != SchemaVersion-1 {
+		t.Errorf("got version %d want: %d", got, SchemaVersion-1)
+	}
+
+	migrations[len(migrations)-1] = `ALTER TABLE card ADD COLUMN extra INTEGER`
+	if e := db.migrate(); e != nil {
+		t.Fatal(e)
+	}
+	if got, _ := db.SchemaVersion(); got != SchemaVersion {
+		t.Errorf("got version %d want: %d", got, SchemaVersion)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	if e := db.CheckWritable(); e != nil {
+		t.Error(e)
+	}
+
+	db.fileName = filepath.Join(t.TempDir(), "missing", "cards.db")
+	if e := db.CheckWritable(); e == nil {
+		t.Error("missing database file reported as writable")
+	}
+}
+
+func TestStudyCard(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, e := db.NewDeck("DeckName")
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	card, _, e := db.StudyCard(deck)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if card != nil {
+		t.Errorf("got: %#v from an empty deck", card)
+	}
+
+	c, e := db.NewCard()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e = db.AddCardToDeck(c.ID, deck.ID); e != nil {
+		t.Fatal(e)
+	}
+
+	card, before, e := db.StudyCard(deck)
+	if e != nil {
+		t.Fatal(e)
+	}
+	got := db.GetCard(c.ID)
+	if card.ID != c.ID || got.Views != 1 || got.LastView.Year() <= 1 {
+		t.Errorf("got: %#v, want card %d viewed once", got, c.ID)
+	}
+	if before.ID != c.ID || before.Views != 0 {
+		t.Errorf("got before: %#v, want card %d unviewed", before, c.ID)
+	}
+}
@@ -0,0 +1,181 @@
+package carddb
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultSimilarity is how alike cards must be for FindDuplicates to group them unless
+// told otherwise
+const DefaultSimilarity = 0.8
+
+// Similarity returns how alike two texts are once normalized with NormalizeAnswer, from 0
+// for nothing in common to 1 for the same. It's 1 minus the edit distance as a fraction of
+// the longer text.
+func Similarity(a, b string) float64 {
+	return similarity([]rune(NormalizeAnswer(a)), []rune(NormalizeAnswer(b)))
+}
+
+func similarity(a, b []rune) float64 {
+	longer := max(len(a), len(b))
+	if longer == 0 {
+		return 1
+	}
+	return 1 - float64(distance(a, b))/float64(longer)
+}
+
+// distance returns the edit distance between a and b. Unlike diff it only keeps two rows
+// of the table, so it takes memory proportional to the shorter length.
+func distance(a, b []rune) int {
+	if len(b) > len(a) {
+		a, b = b, a
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				cur[j] = prev[j-1]
+			} else {
+				cur[j] = 1 + min(prev[j-1], prev[j], cur[j-1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// FindDuplicates returns groups of cards whose fronts and backs are both at least the
+// given Similarity to another card in the group. Cards are in ID order within a group and
+// groups are in the order of their first card.
+func (db *Database) FindDuplicates(minSimilarity float64) ([][]*Card, error) {
+	defer db.observe("FindDuplicates", time.Now())
+	cards, e := db.GetCards(-1)
+	if e != nil {
+		return nil, e
+	}
+	sort.Sort(CardsByID(cards))
+
+	fronts := make([][]rune, len(cards))
+	backs := make([][]rune, len(cards))
+	for i, c := range cards {
+		fronts[i] = []rune(NormalizeAnswer(c.Front))
+		backs[i] = []rune(NormalizeAnswer(c.Back))
+	}
+	// Texts whose lengths differ by too much can't be similar enough, which saves most of
+	// the comparisons
+	couldMatch := func(a, b []rune) bool {
+		longer := max(len(a), len(b))
+		return longer == 0 || 1-float64(abs(len(a)-len(b)))/float64(longer) >= minSimilarity
+	}
+
+	// group[i] is the index of the first card in card i's group
+	group := make([]int, len(cards))
+	for i := range group {
+		group[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if group[i] != i {
+			group[i] = root(group[i])
+		}
+		return group[i]
+	}
+	for i := range cards {
+		for j := i + 1; j < len(cards); j++ {
+			if root(i) == root(j) || !couldMatch(fronts[i], fronts[j]) || !couldMatch(backs[i], backs[j]) {
+				continue
+			}
+			if similarity(fronts[i], fronts[j]) >= minSimilarity && similarity(backs[i], backs[j]) >= minSimilarity {
+				ri, rj := root(i), root(j)
+				group[max(ri, rj)] = min(ri, rj)
+			}
+		}
+	}
+
+	byRoot := make(map[int][]*Card)
+	for i, c := range cards {
+		byRoot[root(i)] = append(byRoot[root(i)], c)
+	}
+	var groups [][]*Card
+	for i := range cards {
+		if g := byRoot[i]; len(g) > 1 {
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// MergeCards merges the cards into the one with ID keepID. The kept card joins all of
+// their decks and gets their tags and reviews, their views are added to its and it takes
+// the latest last view. The others are moved to the trash. Each card's revision history
+// records the change, though reverting only undoes the change to that card: the reviews
+// stay with the kept card.
+func (db *Database) MergeCards(keepID int, cardIDs []int, author string) (*Revision, error) {
+	defer db.observe("MergeCards", time.Now())
+	rev := &Revision{Kind: KindCard, ItemID: keepID, Author: author, Action: ActionEdit}
+	return db.change(rev, func(tx *sql.Tx) error {
+		if rev.Old == nil {
+			return fmt.Errorf("card %d is in the trash", keepID)
+		}
+		keep := &Card{}
+		e := tx.QueryRow(`SELECT views, last_view FROM card WHERE card_id=?`, keepID).Scan(&keep.Views, &keep.LastView)
+		if e != nil {
+			return e
+		}
+
+		for _, id := range cardIDs {
+			if id == keepID {
+				continue
+			}
+			old, e := snapshot(tx, KindCard, id)
+			if e != nil {
+				return e
+			}
+			if old == nil {
+				return fmt.Errorf("card %d is in the trash", id)
+			}
+			c := &Card{}
+			if e := tx.QueryRow(`SELECT views, last_view FROM card WHERE card_id=?`, id).Scan(&c.Views, &c.LastView); e != nil {
+				return e
+			}
+			keep.Views += c.Views
+			if c.LastView.After(keep.LastView) {
+				keep.LastView = c.LastView
+			}
+
+			for _, stmt := range []string{
+				`INSERT OR IGNORE INTO deck_card (deck_id, card_id) SELECT deck_id, ? FROM deck_card WHERE card_id=?`,
+				`INSERT OR IGNORE INTO card_tag (card_id, tag) SELECT ?, tag FROM card_tag WHERE card_id=?`,
+				`UPDATE review SET card_id=? WHERE card_id=?`,
+			} {
+				if _, e := tx.Exec(stmt, keepID, id); e != nil {
+					return e
+				}
+			}
+			if e := apply(tx, KindCard, id, nil); e != nil {
+				return e
+			}
+			trash := &Revision{Kind: KindCard, ItemID: id, Author: author, Action: ActionDelete, Old: old}
+			if e := addRevision(tx, trash); e != nil {
+				return e
+			}
+		}
+
+		_, e = tx.Exec(`UPDATE card SET views=?, last_view=? WHERE card_id=?`, keep.Views, keep.LastView.UTC(), keepID)
+		return e
+	})
+}
@@ -0,0 +1,101 @@
+package carddb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"Hello, World!", "hello world", 1},
+		{"abcd", "abce", 0.75},
+		{"abc", "", 0},
+	}
+	for _, test := range tests {
+		if got := Similarity(test.a, test.b); got != test.want {
+			t.Errorf("Similarity(%q, %q) = %v want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	for _, test := range [][2]string{{"", ""}, {"kitten", "sitting"}, {"abc", ""}, {"flaw", "lawn"}, {"a", "abcdef"}} {
+		a, b := []rune(test[0]), []rune(test[1])
+		if want, _ := diff(a, b); distance(a, b) != want {
+			t.Errorf("distance(%q, %q) = %d want %d", test[0], test[1], distance(a, b), want)
+		}
+	}
+}
+
+func TestFindAndMergeDuplicates(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	spanish, _ := db.NewDeck("Spanish")
+	imported, _ := db.NewDeck("Imported")
+	newCard := func(front, back string, deckID, views int, lastView time.Time) *Card {
+		c, _ := db.NewCard()
+		c.Front = front
+		c.Back = back
+		c.Views = views
+		c.LastView = lastView
+		db.UpdateCard(c)
+		db.AddCardToDeck(c.ID, deckID)
+		return c
+	}
+	now := time.Now().Truncate(time.Second)
+	a := newCard("el perro", "the dog", spanish.ID, 2, now.Add(-time.Hour))
+	b := newCard("El perro.", "The dog", imported.ID, 3, now)
+	c := newCard("el perrro", "the dog!", imported.ID, 0, time.Time{})
+	newCard("el gato", "the cat", spanish.ID, 0, time.Time{})
+
+	groups, e := db.FindDuplicates(DefaultSimilarity)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(groups) != 1 || len(groups[0]) != 3 || groups[0][0].ID != a.ID || groups[0][2].ID != c.ID {
+		t.Fatalf("got groups: %v", groups)
+	}
+	if groups, _ := db.FindDuplicates(1); len(groups) != 1 || len(groups[0]) != 2 {
+		t.Errorf("got exact duplicates: %v", groups)
+	}
+
+	db.AddReview(&Review{CardID: b.ID, DeckID: imported.ID, Grade: GradeGood, Time: now})
+	db.Bulk([]int{b.ID}, BulkAction{Action: BulkTag, Tag: "imported"})
+
+	rev, e := db.MergeCards(a.ID, []int{a.ID, b.ID, c.ID}, "me")
+	if e != nil {
+		t.Fatal(e)
+	}
+	got := db.GetCard(a.ID)
+	if got.Views != 5 || !got.LastView.Equal(now) || rev.ItemID != a.ID {
+		t.Errorf("got kept card: %+v", got)
+	}
+	if db.GetCard(b.ID) != nil || db.GetCard(c.ID) != nil {
+		t.Error("merged cards not trashed")
+	}
+	if decks, _ := db.GetDecks(a.ID); len(decks) != 2 {
+		t.Errorf("got decks: %v", decks)
+	}
+	if reviews, _ := db.GetReviews(a.ID); len(reviews) != 1 {
+		t.Errorf("got reviews: %v", reviews)
+	}
+	if tags, _ := db.GetCardTags(); !reflect.DeepEqual(tags[a.ID], []string{"imported"}) {
+		t.Errorf("got tags: %v", tags)
+	}
+	if groups, _ := db.FindDuplicates(DefaultSimilarity); len(groups) != 0 {
+		t.Errorf("got groups after merging: %v", groups)
+	}
+
+	if _, e := db.MergeCards(a.ID, []int{b.ID}, "me"); e == nil {
+		t.Error("merged a card in the trash")
+	}
+}
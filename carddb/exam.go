@@ -0,0 +1,279 @@
+package carddb
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// ExamGrace is how long after an exam's deadline answers are still accepted, to allow for
+// the time it takes to submit them
+var ExamGrace = 10 * time.Second
+
+// ExamCard is one question of an exam. The card's front and back are copied so the report
+// still makes sense if the card changes later.
+type ExamCard struct {
+	CardID  int
+	Front   string
+	Back    string
+	Answer  string
+	Correct bool
+}
+
+// Exam is a fixed set of cards to be answered within a time limit. Taking one doesn't
+// change the cards' views or last view.
+type Exam struct {
+	ID int
+	// Decks is the names of the decks the cards were drawn from
+	Decks     string
+	Started   time.Time
+	TimeLimit time.Duration
+	// Finished is zero until the answers are in
+	Finished time.Time
+	Cards    []ExamCard
+}
+
+// Deadline is when answers are due
+func (ex *Exam) Deadline() time.Time {
+	return ex.Started.Add(ex.TimeLimit)
+}
+
+// Done returns true once the exam's answers are in
+func (ex *Exam) Done() bool {
+	return !ex.Finished.IsZero()
+}
+
+// Late returns true if the answers came in after the deadline and weren't graded
+func (ex *Exam) Late() bool {
+	return ex.Done() && ex.Finished.After(ex.Deadline().Add(ExamGrace))
+}
+
+// Score returns the number of correct answers
+func (ex *Exam) Score() int {
+	score := 0
+	for _, c := range ex.Cards {
+		if c.Correct {
+			score++
+		}
+	}
+	return score
+}
+
+// Percent returns the score as a percentage
+func (ex *Exam) Percent() float64 {
+	if len(ex.Cards) == 0 {
+		return 0
+	}
+	return 100 * float64(ex.Score()) / float64(len(ex.Cards))
+}
+
+// NewExam starts an exam of up to n cards drawn at random from the given decks, due within
+// timeLimit. Cards in more than one of the decks are only asked once. The limit is kept in
+// whole seconds, so it must be at least a second.
+func (db *Database) NewExam(deckIDs []int, n int, timeLimit time.Duration) (*Exam, error) {
+	defer db.observe("NewExam", time.Now())
+	if len(deckIDs) == 0 {
+		return nil, fmt.Errorf("no decks given")
+	}
+	if n < 1 {
+		return nil, fmt.Errorf("an exam needs at least 1 card")
+	}
+	if timeLimit < time.Second {
+		return nil, fmt.Errorf("time limit must be at least a second")
+	}
+	timeLimit = timeLimit.Truncate(time.Second)
+
+	var names []string
+	var cards []*Card
+	seen := make(map[int]bool)
+	for _, deckID := range deckIDs {
+		deck := db.GetDeck(deckID)
+		if deck == nil {
+			return nil, fmt.Errorf("no deck with ID %d", deckID)
+		}
+		names = append(names, deck.Name)
+
+		deckCards, e := db.GetCards(deckID)
+		if e != nil {
+			return nil, e
+		}
+		for _, c := range deckCards {
+			if !seen[c.ID] {
+				seen[c.ID] = true
+				cards = append(cards, c)
+			}
+		}
+	}
+	if len(cards) == 0 {
+		return nil, fmt.Errorf("the decks have no cards")
+	}
+
+	rand.Shuffle(len(cards), func(i, j int) { cards[i], cards[j] = cards[j], cards[i] })
+	if len(cards) > n {
+		cards = cards[:n]
+	}
+
+	ex := &Exam{
+		Decks:     strings.Join(names, ", "),
+		Started:   time.Now(),
+		TimeLimit: timeLimit,
+	}
+
+	tx, e := db.Begin()
+	if e != nil {
+		return nil, e
+	}
+	res, e := tx.Exec(`
+INSERT INTO exam (decks, started, time_limit)
+VALUES (?, ?, ?)`, ex.Decks, ex.Started.UTC(), int(timeLimit/time.Second))
+	if e != nil {
+		tx.Rollback()
+		return nil, e
+	}
+	id, e := res.LastInsertId()
+	if e != nil {
+		tx.Rollback()
+		return nil, e
+	}
+
+	for i, c := range cards {
+		ex.Cards = append(ex.Cards, ExamCard{CardID: c.ID, Front: c.Front, Back: c.Back})
+		if _, e := tx.Exec(`
+INSERT INTO exam_card (exam_id, position, card_id, front, back)
+VALUES (?, ?, ?, ?, ?)`, id, i, c.ID, c.Front, c.Back); e != nil {
+			tx.Rollback()
+			return nil, e
+		}
+	}
+
+	if e := tx.Commit(); e != nil {
+		return nil, e
+	}
+	ex.ID = int(id)
+	return ex, nil
+}
+
+// GetExam returns the exam with the given ID, or nil if there is no such exam
+func (db *Database) GetExam(examID int) (*Exam, error) {
+	defer db.observe("GetExam", time.Now())
+	ex := &Exam{}
+	var limit int
+	var finished sql.NullTime
+	e := db.QueryRow(`
+SELECT exam_id, decks, started, finished, time_limit
+FROM exam WHERE exam_id=?`, examID).Scan(&ex.ID, &ex.Decks, &ex.Started, &finished, &limit)
+	if e == sql.ErrNoRows {
+		return nil, nil
+	} else if e != nil {
+		return nil, e
+	}
+	ex.Started = ex.Started.Local()
+	ex.TimeLimit = time.Duration(limit) * time.Second
+	if finished.Valid {
+		ex.Finished = finished.Time.Local()
+	}
+
+	rows, e := db.Query(`
+SELECT card_id, front, back, answer, correct
+FROM exam_card
+WHERE exam_id=?
+ORDER BY position`, examID)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+	for rows.Next() {
+		c := ExamCard{}
+		if e := rows.Scan(&c.CardID, &c.Front, &c.Back, &c.Answer, &c.Correct); e != nil {
+			return nil, e
+		}
+		ex.Cards = append(ex.Cards, c)
+	}
+	return ex, rows.Err()
+}
+
+// FinishExam grades the answers, keyed by card ID, with CheckAnswer and stores them. If
+// it's past the deadline, plus ExamGrace, the answers are ignored and every card counts as
+// wrong. An exam can only be finished once.
+func (db *Database) FinishExam(ex *Exam, answers map[int]string) error {
+	defer db.observe("FinishExam", time.Now())
+	if ex.Done() {
+		return fmt.Errorf("exam %d is already finished", ex.ID)
+	}
+	ex.Finished = time.Now()
+	late := ex.Late()
+
+	tx, e := db.Begin()
+	if e != nil {
+		return e
+	}
+	for i := range ex.Cards {
+		c := &ex.Cards[i]
+		if !late {
+			c.Answer = answers[c.CardID]
+			c.Correct = c.Answer != "" && CheckAnswer(c.Answer, c.Back).Correct
+		}
+		if _, e := tx.Exec(`
+UPDATE exam_card
+SET answer=?, correct=?
+WHERE exam_id=? AND position=?`, c.Answer, c.Correct, ex.ID, i); e != nil {
+			tx.Rollback()
+			return e
+		}
+	}
+
+	// Only finish it if no one else has in the mean time
+	res, e := tx.Exec(`
+UPDATE exam
+SET finished=?
+WHERE exam_id=? AND finished IS NULL`, ex.Finished.UTC(), ex.ID)
+	if e != nil {
+		tx.Rollback()
+		return e
+	}
+	if n, e := res.RowsAffected(); e != nil || n != 1 {
+		tx.Rollback()
+		if e == nil {
+			e = fmt.Errorf("exam %d is already finished", ex.ID)
+		}
+		return e
+	}
+	return tx.Commit()
+}
+
+// GetExams returns all exams, newest first
+func (db *Database) GetExams() ([]*Exam, error) {
+	defer db.observe("GetExams", time.Now())
+	rows, e := db.Query(`
+SELECT exam_id
+FROM exam
+ORDER BY started DESC, exam_id DESC`)
+	if e != nil {
+		return nil, e
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if e := rows.Scan(&id); e != nil {
+			rows.Close()
+			return nil, e
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if e := rows.Err(); e != nil {
+		return nil, e
+	}
+
+	exams := make([]*Exam, 0, len(ids))
+	for _, id := range ids {
+		ex, e := db.GetExam(id)
+		if e != nil {
+			return nil, e
+		}
+		exams = append(exams, ex)
+	}
+	return exams, nil
+}
@@ -0,0 +1,114 @@
+package carddb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExam(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck1, _ := db.NewDeck("One")
+	deck2, _ := db.NewDeck("Two")
+	var cards []*Card
+	for i, back := range []string{"red", "green", "blue"} {
+		card, e := db.NewCard()
+		if e != nil {
+			t.Fatal(e)
+		}
+		card.Back = back
+		if e := db.UpdateCard(card); e != nil {
+			t.Fatal(e)
+		}
+		cards = append(cards, card)
+		if e := db.AddCardToDeck(card.ID, deck1.ID); e != nil {
+			t.Fatal(e)
+		}
+		if i == 0 {
+			if e := db.AddCardToDeck(card.ID, deck2.ID); e != nil {
+				t.Fatal(e)
+			}
+		}
+	}
+
+	if _, e := db.NewExam(nil, 1, time.Minute); e == nil {
+		t.Error("expected an error for no decks")
+	}
+	if _, e := db.NewExam([]int{deck1.ID}, 1, time.Second/2); e == nil {
+		t.Error("expected an error for a limit under a second")
+	}
+
+	ex, e := db.NewExam([]int{deck1.ID, deck2.ID}, 10, time.Minute)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(ex.Cards) != 3 || ex.Decks != "One, Two" || ex.Done() {
+		t.Errorf("new exam: %#v", ex)
+	}
+
+	answers := map[int]string{cards[0].ID: "Red", cards[1].ID: "blue"}
+	if e := db.FinishExam(ex, answers); e != nil {
+		t.Fatal(e)
+	}
+	if e := db.FinishExam(ex, answers); e == nil {
+		t.Error("expected an error finishing twice")
+	}
+
+	got, e := db.GetExam(ex.ID)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got == nil || !got.Done() || got.Late() || got.Score() != 1 || got.TimeLimit != time.Minute {
+		t.Errorf("finished exam: %#v", got)
+	}
+	for _, c := range got.Cards {
+		if c.Answer != answers[c.CardID] || c.Correct != (c.CardID == cards[0].ID) {
+			t.Errorf("card: %#v", c)
+		}
+	}
+
+	// Exams don't count as views
+	for _, c := range cards {
+		if got := db.GetCard(c.ID); got.Views != 0 || !got.LastView.Equal(c.LastView) {
+			t.Errorf("card %d changed: %#v", c.ID, got)
+		}
+	}
+}
+
+func TestExamLate(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, _ := db.NewDeck("Deck")
+	card, _ := db.NewCard()
+	if e := db.AddCardToDeck(card.ID, deck.ID); e != nil {
+		t.Fatal(e)
+	}
+
+	ex, e := db.NewExam([]int{deck.ID}, 1, time.Second)
+	if e != nil {
+		t.Fatal(e)
+	}
+	ex.Started = ex.Started.Add(-time.Hour)
+	if e := db.FinishExam(ex, map[int]string{card.ID: card.Back}); e != nil {
+		t.Fatal(e)
+	}
+	if !ex.Late() || ex.Score() != 0 || ex.Cards[0].Answer != "" {
+		t.Errorf("late exam: %#v", ex)
+	}
+
+	exams, e := db.GetExams()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(exams) != 1 || exams[0].ID != ex.ID || len(exams[0].Cards) != 1 {
+		t.Errorf("exams: %#v", exams)
+	}
+}
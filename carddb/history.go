@@ -0,0 +1,433 @@
+package carddb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Actions recorded in revisions
+const (
+	ActionEdit   = "edit"
+	ActionDelete = "delete"
+	ActionGrade  = "grade"
+	ActionRevert = "revert"
+)
+
+// Kinds of item a revision is of
+const (
+	KindCard = "card"
+	KindDeck = "deck"
+)
+
+// execer is satisfied by both *Database and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Revision is a recorded change to a card or deck, with the values from before so it can
+// be reverted
+type Revision struct {
+	ID     int
+	Kind   string
+	ItemID int
+	Time   time.Time
+	// Author is who made the change, e.g. the address of the web client
+	Author string
+	Action string
+	// Old and New are the item as JSON before and after the change. They're nil when the
+	// item was in the trash.
+	Old, New json.RawMessage
+	// ReviewID is the review logged by a grade, or put back by reverting the revert of one.
+	// It's deleted if the revision is reverted.
+	ReviewID int
+	// DeletedReview is the review a revert deleted, as JSON
+	DeletedReview json.RawMessage
+	// Reverts is the ID of the revision a revert reverted
+	Reverts int
+}
+
+// Change is a field that changed in a revision
+type Change struct {
+	Field    string
+	Old, New string
+	// Diff is set for text fields short enough to compare
+	Diff []DiffSegment
+}
+
+// Changes returns the fields that differ between Old and New, in alphabetical order. A
+// revision that moved the item to or from the trash has none.
+func (r *Revision) Changes() []Change {
+	var before, after map[string]interface{}
+	if json.Unmarshal(r.Old, &before) != nil || json.Unmarshal(r.New, &after) != nil || before == nil || after == nil {
+		return nil
+	}
+	var changes []Change
+	for field, o := range before {
+		n := after[field]
+		if field == "ID" || fmt.Sprint(o) == fmt.Sprint(n) {
+			continue
+		}
+		c := Change{Field: field, Old: fmt.Sprint(o), New: fmt.Sprint(n)}
+		if oldText, ok := o.(string); ok {
+			if newText, ok := n.(string); ok {
+				c.Diff = Diff(oldText, newText)
+			}
+		}
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// Trashed returns true if the revision moved the item to the trash
+func (r *Revision) Trashed() bool {
+	return r.Old != nil && r.New == nil
+}
+
+// Restored returns true if the revision took the item out of the trash
+func (r *Revision) Restored() bool {
+	return r.Old == nil && r.New != nil
+}
+
+// Summary describes the revision in a few words, e.g. "Edited card 3"
+func (r *Revision) Summary() string {
+	switch {
+	case r.Action == ActionRevert:
+		return fmt.Sprintf("Reverted %s %d", r.Kind, r.ItemID)
+	case r.Action == ActionGrade:
+		return fmt.Sprintf("Graded %s %d", r.Kind, r.ItemID)
+	case r.Trashed():
+		return fmt.Sprintf("Moved %s %d to the trash", r.Kind, r.ItemID)
+	}
+	return fmt.Sprintf("Edited %s %d", r.Kind, r.ItemID)
+}
+
+// snapshot returns the item as JSON, or nil if it's in the trash
+func snapshot(ex execer, kind string, id int) (json.RawMessage, error) {
+	var item interface{}
+	var deleted sql.NullTime
+	var e error
+	switch kind {
+	case KindCard:
+		c := &Card{}
+		e = ex.QueryRow(`
+SELECT card_id, front, back, views, last_view, suspended, leech, deleted
+FROM card WHERE card_id=?`, id).Scan(&c.ID, &c.Front, &c.Back, &c.Views, &c.LastView, &c.Suspended, &c.Leech, &deleted)
+		c.LastView = c.LastView.Local()
+		item = c
+	case KindDeck:
+		d := &deckSnapshot{PresetID: new(int), Overrides: new(string)}
+		var presetID sql.NullInt64
+		e = ex.QueryRow(`
+SELECT deck_id, name, date_weight, view_weight, view_limit, type_answer, leech_threshold, leech_suspend, deleted,
+  preset_id, overrides
+FROM deck WHERE deck_id=?`, id).Scan(&d.ID, &d.Name, &d.DateWeight, &d.ViewWeight, &d.ViewLimit, &d.TypeAnswer,
+			&d.LeechThreshold, &d.LeechSuspend, &deleted, &presetID, d.Overrides)
+		*d.PresetID = int(presetID.Int64)
+		item = d
+	default:
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+	if e == sql.ErrNoRows {
+		return nil, fmt.Errorf("%s %d no longer exists", kind, id)
+	}
+	if e != nil || deleted.Valid {
+		return nil, e
+	}
+	return json.Marshal(item)
+}
+
+// deckSnapshot is a deck as recorded in revisions, with its preset link. PresetID is 0
+// for no preset and Overrides are joined by commas. They're nil in revisions recorded
+// before presets were, which leave the link alone when applied.
+type deckSnapshot struct {
+	Deck
+	PresetID  *int    `json:",omitempty"`
+	Overrides *string `json:",omitempty"`
+}
+
+// apply puts the item in the state given by snapshot, which is nil for the trash
+func apply(ex execer, kind string, id int, snapshot json.RawMessage) error {
+	if snapshot == nil {
+		_, e := ex.Exec(`UPDATE `+kind+` SET deleted=? WHERE `+kind+`_id=? AND deleted IS NULL`, time.Now().UTC(), id)
+		return e
+	}
+
+	if _, e := ex.Exec(`UPDATE `+kind+` SET deleted=NULL WHERE `+kind+`_id=?`, id); e != nil {
+		return e
+	}
+	switch kind {
+	case KindCard:
+		c := &Card{}
+		if e := json.Unmarshal(snapshot, c); e != nil {
+			return e
+		}
+		c.ID = id
+		return updateCard(ex, c)
+	case KindDeck:
+		d := &deckSnapshot{}
+		if e := json.Unmarshal(snapshot, d); e != nil {
+			return e
+		}
+		d.ID = id
+		if d.PresetID != nil && d.Overrides != nil {
+			if e := setDeckPreset(ex, id, *d.PresetID, *d.Overrides); e != nil {
+				return e
+			}
+		}
+		return updateDeck(ex, &d.Deck)
+	}
+	return fmt.Errorf("unknown kind %q", kind)
+}
+
+// addRevision inserts rev, setting its ID and time
+func addRevision(ex execer, rev *Revision) error {
+	rev.Time = time.Now()
+	res, e := ex.Exec(`
+INSERT INTO revision (kind, item_id, time, author, action, old, new, review_id, reverts, deleted_review)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, rev.Kind, rev.ItemID, rev.Time.UTC(), rev.Author, rev.Action,
+		nullJSON(rev.Old), nullJSON(rev.New), nullInt(rev.ReviewID), nullInt(rev.Reverts), nullJSON(rev.DeletedReview))
+	if e != nil {
+		return e
+	}
+	id, e := res.LastInsertId()
+	rev.ID = int(id)
+	return e
+}
+
+func nullJSON(j json.RawMessage) interface{} {
+	if j == nil {
+		return nil
+	}
+	return string(j)
+}
+
+func nullInt(i int) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+// change runs fn in a transaction and records the change it makes to the item given by
+// rev's Kind and ItemID as rev
+func (db *Database) change(rev *Revision, fn func(tx *sql.Tx) error) (*Revision, error) {
+	tx, e := db.Begin()
+	if e != nil {
+		return nil, e
+	}
+	if rev.Old, e = snapshot(tx, rev.Kind, rev.ItemID); e == nil {
+		if e = fn(tx); e == nil {
+			if rev.New, e = snapshot(tx, rev.Kind, rev.ItemID); e == nil {
+				e = addRevision(tx, rev)
+			}
+		}
+	}
+	if e != nil {
+		tx.Rollback()
+		return nil, e
+	}
+	return rev, tx.Commit()
+}
+
+// EditCard saves the card like UpdateCard and records the change
+func (db *Database) EditCard(card *Card, author string) (*Revision, error) {
+	defer db.observe("EditCard", time.Now())
+	rev := &Revision{Kind: KindCard, ItemID: card.ID, Author: author, Action: ActionEdit}
+	return db.change(rev, func(tx *sql.Tx) error {
+		return updateCard(tx, card)
+	})
+}
+
+// EditDeck saves the deck like UpdateDeck and records the change
+func (db *Database) EditDeck(deck *Deck, author string) (*Revision, error) {
+	defer db.observe("EditDeck", time.Now())
+	rev := &Revision{Kind: KindDeck, ItemID: deck.ID, Author: author, Action: ActionEdit}
+	return db.change(rev, func(tx *sql.Tx) error {
+		return updateDeck(tx, deck)
+	})
+}
+
+// EditDeckPreset links the deck to the preset like SetDeckPreset and saves it like
+// EditDeck, recording both as one change
+func (db *Database) EditDeckPreset(deck *Deck, presetID int, overrides []string, author string) (*Revision, error) {
+	defer db.observe("EditDeckPreset", time.Now())
+	if e := db.CheckDeckPreset(presetID, overrides); e != nil {
+		return nil, e
+	}
+	rev := &Revision{Kind: KindDeck, ItemID: deck.ID, Author: author, Action: ActionEdit}
+	return db.change(rev, func(tx *sql.Tx) error {
+		if e := setDeckPreset(tx, deck.ID, presetID, strings.Join(overrides, ",")); e != nil {
+			return e
+		}
+		return updateDeck(tx, deck)
+	})
+}
+
+// TrashCard moves the card to the trash like DelCard and records the change
+func (db *Database) TrashCard(cardID int, author string) (*Revision, error) {
+	defer db.observe("TrashCard", time.Now())
+	rev := &Revision{Kind: KindCard, ItemID: cardID, Author: author, Action: ActionDelete}
+	return db.change(rev, func(tx *sql.Tx) error {
+		return apply(tx, KindCard, cardID, nil)
+	})
+}
+
+// TrashDeck moves the deck to the trash like DelDeck and records the change
+func (db *Database) TrashDeck(deckID int, author string) (*Revision, error) {
+	defer db.observe("TrashDeck", time.Now())
+	rev := &Revision{Kind: KindDeck, ItemID: deckID, Author: author, Action: ActionDelete}
+	return db.change(rev, func(tx *sql.Tx) error {
+		return apply(tx, KindDeck, deckID, nil)
+	})
+}
+
+// GradeCard saves the card, logs the review of it and records both as a revision so they
+// can be undone together. before is the card as it was before it was studied, which the
+// revision reverts to.
+func (db *Database) GradeCard(before, card *Card, review *Review, author string) (*Revision, error) {
+	defer db.observe("GradeCard", time.Now())
+	tx, e := db.Begin()
+	if e != nil {
+		return nil, e
+	}
+	rev := &Revision{Kind: KindCard, ItemID: card.ID, Author: author, Action: ActionGrade}
+	if rev.Old, e = json.Marshal(before); e == nil {
+		if e = updateCard(tx, card); e == nil {
+			if e = addReview(tx, review); e == nil {
+				rev.ReviewID = review.ID
+				if rev.New, e = snapshot(tx, KindCard, card.ID); e == nil {
+					e = addRevision(tx, rev)
+				}
+			}
+		}
+	}
+	if e != nil {
+		tx.Rollback()
+		return nil, e
+	}
+	return rev, tx.Commit()
+}
+
+// Revert puts the item back the way it was before the revision, deleting the review of a
+// grade, and records that as a new revision. Reverting that undoes the revert, putting the
+// review back.
+func (db *Database) Revert(revisionID int, author string) (*Revision, error) {
+	defer db.observe("Revert", time.Now())
+	rev, e := db.GetRevision(revisionID)
+	if e != nil {
+		return nil, e
+	}
+	if rev == nil {
+		return nil, fmt.Errorf("no revision with ID %d", revisionID)
+	}
+
+	revert := &Revision{Kind: rev.Kind, ItemID: rev.ItemID, Author: author, Action: ActionRevert, Reverts: rev.ID}
+	return db.change(revert, func(tx *sql.Tx) error {
+		if rev.ReviewID != 0 {
+			if e := deleteReview(tx, rev.ReviewID, revert); e != nil {
+				return e
+			}
+		}
+		if rev.DeletedReview != nil {
+			if e := restoreReview(tx, rev.DeletedReview, revert); e != nil {
+				return e
+			}
+		}
+		return apply(tx, rev.Kind, rev.ItemID, rev.Old)
+	})
+}
+
+// deleteReview deletes the review with the given ID, keeping it in revert so it can be put
+// back. It may already have been deleted some other way.
+func deleteReview(tx *sql.Tx, reviewID int, revert *Revision) error {
+	rows, e := tx.Query(`
+SELECT review_id, card_id, deck_id, time, grade, answer, duration
+FROM review WHERE review_id=?`, reviewID)
+	if e != nil {
+		return e
+	}
+	reviews, e := scanReviews(rows)
+	if e != nil || len(reviews) == 0 {
+		return e
+	}
+	if revert.DeletedReview, e = json.Marshal(reviews[0]); e != nil {
+		return e
+	}
+	_, e = tx.Exec(`DELETE FROM review WHERE review_id=?`, reviewID)
+	return e
+}
+
+// restoreReview puts back a review deleted by a revert, with its old ID, and sets it as
+// revert's review
+func restoreReview(tx *sql.Tx, deleted json.RawMessage, revert *Revision) error {
+	var r Review
+	if e := json.Unmarshal(deleted, &r); e != nil {
+		return e
+	}
+	_, e := tx.Exec(`
+INSERT INTO review (review_id, card_id, deck_id, time, grade, answer, duration)
+VALUES (?, ?, ?, ?, ?, ?, ?)`, r.ID, r.CardID, r.DeckID, r.Time.UTC(), r.Grade, r.Answer, r.Duration.Milliseconds())
+	if e != nil {
+		return e
+	}
+	revert.ReviewID = r.ID
+	return nil
+}
+
+// GetRevision returns the revision with the given ID, or nil if there is no such revision
+func (db *Database) GetRevision(revisionID int) (*Revision, error) {
+	defer db.observe("GetRevision", time.Now())
+	revs, e := db.getRevisions(`WHERE revision_id=?`, revisionID)
+	if e != nil || len(revs) == 0 {
+		return nil, e
+	}
+	return revs[0], nil
+}
+
+// GetRevisions returns the revisions of the card or deck, newest first
+func (db *Database) GetRevisions(kind string, itemID int) ([]*Revision, error) {
+	defer db.observe("GetRevisions", time.Now())
+	return db.getRevisions(`WHERE kind=? AND item_id=? ORDER BY revision_id DESC`, kind, itemID)
+}
+
+func (db *Database) getRevisions(where string, args ...interface{}) ([]*Revision, error) {
+	rows, e := db.Query(`
+SELECT revision_id, kind, item_id, time, author, action, old, new, review_id, reverts, deleted_review
+FROM revision `+where, args...)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+
+	var revs []*Revision
+	for rows.Next() {
+		r := &Revision{}
+		var before, after, deletedReview sql.NullString
+		var reviewID, reverts sql.NullInt64
+		e := rows.Scan(&r.ID, &r.Kind, &r.ItemID, &r.Time, &r.Author, &r.Action, &before, &after, &reviewID, &reverts,
+			&deletedReview)
+		if e != nil {
+			return nil, e
+		}
+		r.Time = r.Time.Local()
+		if before.Valid {
+			r.Old = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			r.New = json.RawMessage(after.String)
+		}
+		if deletedReview.Valid {
+			r.DeletedReview = json.RawMessage(deletedReview.String)
+		}
+		r.ReviewID = int(reviewID.Int64)
+		r.Reverts = int(reverts.Int64)
+		revs = append(revs, r)
+	}
+	return revs, rows.Err()
+}
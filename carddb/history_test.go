@@ -0,0 +1,212 @@
+package carddb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	got := Diff("the cat sat", "the dog sat")
+	want := []DiffSegment{{DiffEqual, "the "}, {DiffExtra, "cat"}, {DiffMissing, "dog"}, {DiffEqual, " sat"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v want: %v", got, want)
+	}
+
+	long := strings.Repeat("a", 10000)
+	if got := Diff(long, long+"b"); got != nil {
+		t.Errorf("got a diff of %d segments for long texts", len(got))
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	card, _ := db.NewCard()
+	card.Front = "hola"
+	card.Back = "hello"
+	db.UpdateCard(card)
+
+	card.Front = "adios"
+	edit, e := db.EditCard(card, "me")
+	if e != nil {
+		t.Fatal(e)
+	}
+	changes := edit.Changes()
+	if len(changes) != 1 || changes[0].Field != "Front" || changes[0].Old != "hola" || changes[0].New != "adios" ||
+		len(changes[0].Diff) == 0 {
+		t.Errorf("got changes: %+v", changes)
+	}
+
+	// Undo and redo the edit
+	undo, e := db.Revert(edit.ID, "you")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := db.GetCard(card.ID); got.Front != "hola" || got.Back != "hello" {
+		t.Errorf("got after undo: %+v", got)
+	}
+	if undo.Reverts != edit.ID || undo.Author != "you" || undo.Summary() != fmt.Sprintf("Reverted card %d", card.ID) {
+		t.Errorf("got revert: %+v", undo)
+	}
+	if _, e := db.Revert(undo.ID, "you"); e != nil {
+		t.Fatal(e)
+	}
+	if got := db.GetCard(card.ID); got.Front != "adios" {
+		t.Errorf("got after redo: %+v", got)
+	}
+
+	// Undo a delete
+	trash, e := db.TrashCard(card.ID, "me")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !trash.Trashed() || db.GetCard(card.ID) != nil {
+		t.Errorf("card not trashed: %+v", trash)
+	}
+	if _, e := db.Revert(trash.ID, "me"); e != nil {
+		t.Fatal(e)
+	}
+	if got := db.GetCard(card.ID); got == nil || got.Front != "adios" {
+		t.Errorf("got after undoing delete: %+v", got)
+	}
+
+	revs, e := db.GetRevisions(KindCard, card.ID)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(revs) != 5 || revs[0].Action != ActionRevert || revs[4].ID != edit.ID || revs[4].Author != "me" {
+		t.Errorf("got revisions: %+v", revs)
+	}
+
+	// Purging the card removes its history
+	db.DelCard(card.ID)
+	db.PurgeCard(card.ID)
+	if revs, _ := db.GetRevisions(KindCard, card.ID); len(revs) != 0 {
+		t.Errorf("got revisions of purged card: %+v", revs)
+	}
+	if _, e := db.Revert(edit.ID, "me"); e == nil {
+		t.Error("reverted a purged card")
+	}
+}
+
+func TestGradeCardRevert(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, _ := db.NewDeck("Deck")
+	card, _ := db.NewCard()
+	db.AddCardToDeck(card.ID, deck.ID)
+
+	studied, before, e := db.StudyCard(deck)
+	if e != nil {
+		t.Fatal(e)
+	}
+	rev, e := db.GradeCard(before, studied, &Review{CardID: card.ID, DeckID: deck.ID, Grade: GradeGood}, "me")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if reviews, _ := db.GetReviews(card.ID); len(reviews) != 1 || rev.ReviewID != reviews[0].ID {
+		t.Errorf("got reviews: %+v revision: %+v", reviews, rev)
+	}
+
+	if _, e := db.Revert(rev.ID, "me"); e != nil {
+		t.Fatal(e)
+	}
+	if got := db.GetCard(card.ID); got.Views != 0 || got.LastView.Year() > 1 {
+		t.Errorf("got after undoing grade: %+v", got)
+	}
+	reviews, _ := db.GetReviews(card.ID)
+	if len(reviews) != 0 {
+		t.Errorf("got reviews after undoing grade: %+v", reviews)
+	}
+	revs, _ := db.GetRevisions(KindCard, card.ID)
+	if len(revs) != 2 || revs[0].DeletedReview == nil {
+		t.Fatalf("got revisions: %+v", revs)
+	}
+
+	// Reverting the revert puts the review back, and reverting that takes it away again
+	redo, e := db.Revert(revs[0].ID, "me")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := db.GetCard(card.ID); got.Views != 1 {
+		t.Errorf("got after redoing grade: %+v", got)
+	}
+	reviews, _ = db.GetReviews(card.ID)
+	if len(reviews) != 1 || reviews[0].ID != rev.ReviewID || reviews[0].Grade != GradeGood ||
+		redo.ReviewID != rev.ReviewID {
+		t.Errorf("got reviews after redoing grade: %+v revision: %+v", reviews, redo)
+	}
+	if all, _ := db.GetDeckReviews(deck.ID, time.Time{}); len(all) != 1 {
+		t.Errorf("got deck reviews after redoing grade: %+v", all)
+	}
+	if _, e := db.Revert(redo.ID, "me"); e != nil {
+		t.Fatal(e)
+	}
+	if reviews, _ := db.GetReviews(card.ID); len(reviews) != 0 {
+		t.Errorf("got reviews after undoing again: %+v", reviews)
+	}
+}
+
+func TestEditDeckRevert(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, _ := db.NewDeck("Before")
+	deck.Name = "After"
+	deck.ViewLimit = 99
+	rev, e := db.EditDeck(deck, "me")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if changes := rev.Changes(); len(changes) != 2 || changes[0].Field != "Name" || changes[1].Field != "ViewLimit" {
+		t.Errorf("got changes: %+v", changes)
+	}
+	if _, e := db.Revert(rev.ID, "me"); e != nil {
+		t.Fatal(e)
+	}
+	if got := db.GetDeck(deck.ID); got.Name != "Before" || got.ViewLimit == 99 {
+		t.Errorf("got after revert: %+v", got)
+	}
+
+	// Linking a preset in the same edit is undone with it
+	preset, _ := db.NewPreset("Preset")
+	preset.ViewWeight = 7
+	if e := db.UpdatePreset(preset); e != nil {
+		t.Fatal(e)
+	}
+	deck = db.GetDeck(deck.ID)
+	deck.Name = "Linked"
+	rev, e = db.EditDeckPreset(deck, preset.ID, []string{OptionViewLimit}, "me")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := db.GetDeck(deck.ID); got.Name != "Linked" || got.ViewWeight != 7 {
+		t.Errorf("got after linking: %+v", got)
+	}
+	if _, e := db.Revert(rev.ID, "me"); e != nil {
+		t.Fatal(e)
+	}
+	if got := db.GetDeck(deck.ID); got.Name != "Before" || got.ViewWeight != 1 {
+		t.Errorf("got after undoing the link: %+v", got)
+	}
+	if presetID, overrides, e := db.GetDeckPreset(deck.ID); presetID != 0 || overrides != nil || e != nil {
+		t.Errorf("still linked to preset %d with %v: %v", presetID, overrides, e)
+	}
+	if _, e := db.EditDeckPreset(deck, preset.ID, []string{"bogus"}, "me"); e == nil {
+		t.Error("linked with a bogus override")
+	}
+}
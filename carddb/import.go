@@ -0,0 +1,61 @@
+package carddb
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ImportDeck is a deck to add with Import, with the IDs its cards have among the imported
+// cards
+type ImportDeck struct {
+	*Deck
+	Cards []int
+}
+
+// Import adds the cards and decks as new items in a single transaction, so either all of
+// them are added or none are. The cards keep their stats. It returns maps from the IDs in
+// cards and decks to the new IDs.
+func (db *Database) Import(cards []*Card, decks []ImportDeck) (cardIDs, deckIDs map[int]int, e error) {
+	defer db.observe("Import", time.Now())
+	cardIDs, deckIDs = make(map[int]int), make(map[int]int)
+	e = db.inTx(func(tx *sql.Tx) error {
+		for _, c := range cards {
+			res, e := tx.Exec(`
+INSERT INTO card (front, back, views, last_view, suspended, leech)
+VALUES (?, ?, ?, ?, ?, ?)`, c.Front, c.Back, c.Views, c.LastView.UTC(), c.Suspended, c.Leech)
+			if e != nil {
+				return e
+			}
+			id, e := res.LastInsertId()
+			if e != nil {
+				return e
+			}
+			cardIDs[c.ID] = int(id)
+		}
+
+		for _, d := range decks {
+			res, e := tx.Exec(`
+INSERT INTO deck (name, date_weight, view_weight, view_limit, type_answer, leech_threshold, leech_suspend)
+VALUES (?, ?, ?, ?, ?, ?, ?)`, d.Name, d.DateWeight, d.ViewWeight, d.ViewLimit, d.TypeAnswer, d.LeechThreshold,
+				d.LeechSuspend)
+			if e != nil {
+				return e
+			}
+			id, e := res.LastInsertId()
+			if e != nil {
+				return e
+			}
+			deckIDs[d.ID] = int(id)
+			for _, oldID := range d.Cards {
+				if _, e := tx.Exec(`INSERT INTO deck_card (deck_id, card_id) VALUES (?, ?)`, id, cardIDs[oldID]); e != nil {
+					return e
+				}
+			}
+		}
+		return nil
+	})
+	if e != nil {
+		return nil, nil, e
+	}
+	return cardIDs, deckIDs, nil
+}
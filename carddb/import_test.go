@@ -0,0 +1,39 @@
+package carddb
+
+import (
+	"testing"
+)
+
+func TestImport(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	cards := []*Card{{ID: 10, Front: "a", Views: 2}, {ID: 20, Front: "b"}}
+	decks := []ImportDeck{{&Deck{ID: 5, Name: "Deck", DateWeight: 2, ViewWeight: 1}, []int{10, 20}}}
+	cardIDs, deckIDs, e := db.Import(cards, decks)
+	if e != nil {
+		t.Fatal(e)
+	}
+	deck := db.GetDeck(deckIDs[5])
+	if deck == nil || deck.Name != "Deck" || deck.DateWeight != 2 {
+		t.Errorf("got deck: %+v", deck)
+	}
+	if got, _ := db.GetCards(deck.ID); len(got) != 2 {
+		t.Errorf("got deck cards: %v", got)
+	}
+	if c := db.GetCard(cardIDs[10]); c == nil || c.Front != "a" || c.Views != 2 {
+		t.Errorf("got card: %+v", c)
+	}
+
+	// A card listed twice in a deck fails the whole import
+	decks[0].Cards = []int{10, 10}
+	if _, _, e := db.Import(cards, decks); e == nil {
+		t.Error("imported a deck with a card twice")
+	}
+	if all, _ := db.GetCards(-1); len(all) != 2 {
+		t.Errorf("failed import left %d cards", len(all))
+	}
+}
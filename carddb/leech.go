@@ -0,0 +1,82 @@
+package carddb
+
+import (
+	"time"
+)
+
+// DefaultLeechThreshold is the leech threshold of new decks, as set by the schema
+const DefaultLeechThreshold = 8
+
+// Studyable returns the cards that aren't suspended
+func Studyable(cards []*Card) []*Card {
+	var cs []*Card
+	for _, c := range cards {
+		if !c.Suspended {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// Failures returns the number of reviews of the card in the deck that weren't passed
+func (db *Database) Failures(cardID, deckID int) (int, error) {
+	defer db.observe("Failures", time.Now())
+	var n int
+	e := db.QueryRow(`
+SELECT COUNT(*)
+FROM review
+WHERE card_id=? AND deck_id=? AND grade NOT IN (?, ?)`, cardID, deckID, GradeCorrect, GradeGood).Scan(&n)
+	return n, e
+}
+
+// CheckLeech flags the card as a leech, and suspends it if the deck says to, when it has
+// been failed in the deck the deck's LeechThreshold number of times. After that it's
+// flagged again every half threshold failures, so a card that was unsuspended and is still
+// failing comes back to attention. It should be called after each failure and returns
+// true if the card was flagged.
+func (db *Database) CheckLeech(deck *Deck, card *Card) (bool, error) {
+	if deck.LeechThreshold <= 0 {
+		return false, nil
+	}
+	failures, e := db.Failures(card.ID, deck.ID)
+	if e != nil {
+		return false, e
+	}
+
+	again := deck.LeechThreshold / 2
+	if again < 1 {
+		again = 1
+	}
+	if failures < deck.LeechThreshold || (failures-deck.LeechThreshold)%again != 0 {
+		return false, nil
+	}
+
+	card.Leech = true
+	if deck.LeechSuspend {
+		card.Suspended = true
+	}
+	return true, db.UpdateCard(card)
+}
+
+// SetSuspended suspends or unsuspends the cards with the given IDs. Unsuspending also
+// clears the leech flag.
+func (db *Database) SetSuspended(cardIDs []int, suspended bool) error {
+	defer db.observe("SetSuspended", time.Now())
+	tx, e := db.Begin()
+	if e != nil {
+		return e
+	}
+	for _, id := range cardIDs {
+		var e error
+		if suspended {
+			_, e = tx.Exec(`UPDATE card SET suspended=1 WHERE card_id=?`, id)
+		} else {
+			_, e = tx.Exec(`UPDATE card SET suspended=0, leech=0 WHERE card_id=?`, id)
+		}
+		if e != nil {
+			tx.Rollback()
+			return e
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,88 @@
+package carddb
+
+import (
+	"testing"
+)
+
+func TestRandomCardSkipsSuspended(t *testing.T) {
+	deck := &Deck{DateWeight: 1, ViewWeight: 1, ViewLimit: 1}
+	cards := []*Card{{ID: 1, Suspended: true}, {ID: 2}}
+	for i := 0; i < 20; i++ {
+		if got := RandomCard(deck, cards); got == nil || got.ID != 2 {
+			t.Fatalf("got: %#v", got)
+		}
+	}
+	if got := RandomCard(deck, cards[:1]); got != nil {
+		t.Errorf("only suspended cards got: %#v", got)
+	}
+}
+
+func TestCheckLeech(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, _ := db.NewDeck("Deck")
+	deck.LeechThreshold = 4
+	deck.LeechSuspend = true
+	if e := db.UpdateDeck(deck); e != nil {
+		t.Fatal(e)
+	}
+	card, _ := db.NewCard()
+	if e := db.AddCardToDeck(card.ID, deck.ID); e != nil {
+		t.Fatal(e)
+	}
+
+	fail := func() bool {
+		t.Helper()
+		if e := db.AddReview(&Review{CardID: card.ID, DeckID: deck.ID, Grade: GradeAgain}); e != nil {
+			t.Fatal(e)
+		}
+		flagged, e := db.CheckLeech(deck, card)
+		if e != nil {
+			t.Fatal(e)
+		}
+		return flagged
+	}
+
+	// Passes and failures in other decks don't count
+	other, _ := db.NewDeck("Other")
+	if e := db.AddReview(&Review{CardID: card.ID, DeckID: deck.ID, Grade: GradeGood}); e != nil {
+		t.Fatal(e)
+	}
+	if e := db.AddReview(&Review{CardID: card.ID, DeckID: other.ID, Grade: GradeIncorrect}); e != nil {
+		t.Fatal(e)
+	}
+	for i := 1; i <= 3; i++ {
+		if fail() {
+			t.Errorf("flagged after %d failures", i)
+		}
+	}
+	if !fail() {
+		t.Error("not flagged at the threshold")
+	}
+	if got := db.GetCard(card.ID); !got.Leech || !got.Suspended {
+		t.Errorf("got: %#v", got)
+	}
+
+	if e := db.SetSuspended([]int{card.ID}, false); e != nil {
+		t.Fatal(e)
+	}
+	card = db.GetCard(card.ID)
+	if card.Leech || card.Suspended {
+		t.Errorf("unsuspended got: %#v", card)
+	}
+	// Flagged again every half threshold
+	if fail() || !fail() {
+		t.Error("not flagged again after half the threshold")
+	}
+
+	if e := db.SetSuspended([]int{card.ID}, true); e != nil {
+		t.Fatal(e)
+	}
+	if cards, _ := db.GetCards(deck.ID); len(cards) != 1 || !cards[0].Suspended {
+		t.Errorf("suspended cards should still be listed, got: %#v", cards)
+	}
+}
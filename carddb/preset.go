@@ -0,0 +1,203 @@
+package carddb
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Deck options that presets set, named by their columns in the deck and preset tables
+const (
+	OptionDateWeight     = "date_weight"
+	OptionViewWeight     = "view_weight"
+	OptionViewLimit      = "view_limit"
+	OptionTypeAnswer     = "type_answer"
+	OptionLeechThreshold = "leech_threshold"
+	OptionLeechSuspend   = "leech_suspend"
+)
+
+// DeckOptions are all the options a preset sets. A new option needs a column in both
+// tables and a field in both Deck and Preset.
+var DeckOptions = []string{OptionDateWeight, OptionViewWeight, OptionViewLimit, OptionTypeAnswer,
+	OptionLeechThreshold, OptionLeechSuspend}
+
+// Preset is a named set of deck options shared by the decks linked to it
+type Preset struct {
+	ID             int
+	Name           string
+	DateWeight     float64
+	ViewWeight     float64
+	ViewLimit      int
+	TypeAnswer     bool
+	LeechThreshold int
+	LeechSuspend   bool
+	// Decks is the number of decks linked to the preset, including those in the trash
+	Decks int
+}
+
+// applyPreset copies the options of their presets to the decks matching where, except for
+// the ones each deck overrides
+func applyPreset(ex execer, where string, args ...interface{}) error {
+	for _, option := range DeckOptions {
+		_, e := ex.Exec(`
+UPDATE deck
+SET `+option+`=(SELECT `+option+` FROM preset WHERE preset.preset_id=deck.preset_id)
+WHERE preset_id IS NOT NULL AND instr(','||overrides||',', ',`+option+`,')=0 AND `+where, args...)
+		if e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// NewPreset creates a preset with the given name and default options
+func (db *Database) NewPreset(name string) (*Preset, error) {
+	defer db.observe("NewPreset", time.Now())
+	res, e := db.Exec(`INSERT INTO preset (name) VALUES (?)`, name)
+	if e != nil {
+		return nil, e
+	}
+	id, e := res.LastInsertId()
+	if e != nil {
+		return nil, e
+	}
+	p := db.GetPreset(int(id))
+	if p == nil {
+		return nil, fmt.Errorf("preset %d wasn't created", id)
+	}
+	return p, nil
+}
+
+// GetPreset returns the preset with the given ID, or nil if there is no such preset
+func (db *Database) GetPreset(presetID int) *Preset {
+	defer db.observe("GetPreset", time.Now())
+	presets, e := db.getPresets(`WHERE preset_id=?`, presetID)
+	if e != nil || len(presets) == 0 {
+		return nil
+	}
+	return presets[0]
+}
+
+// GetPresets returns all presets sorted by name
+func (db *Database) GetPresets() ([]*Preset, error) {
+	defer db.observe("GetPresets", time.Now())
+	return db.getPresets(`ORDER BY name, preset_id`)
+}
+
+func (db *Database) getPresets(query string, args ...interface{}) ([]*Preset, error) {
+	rows, e := db.Query(`
+SELECT preset_id, name, date_weight, view_weight, view_limit, type_answer, leech_threshold, leech_suspend,
+  (SELECT COUNT(*) FROM deck WHERE deck.preset_id=preset.preset_id)
+FROM preset `+query, args...)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+	var ps []*Preset
+	for rows.Next() {
+		p := &Preset{}
+		if e := rows.Scan(&p.ID, &p.Name, &p.DateWeight, &p.ViewWeight, &p.ViewLimit, &p.TypeAnswer,
+			&p.LeechThreshold, &p.LeechSuspend, &p.Decks); e != nil {
+			return nil, e
+		}
+		ps = append(ps, p)
+	}
+	return ps, rows.Err()
+}
+
+// UpdatePreset saves the preset and applies its options to the decks linked to it
+func (db *Database) UpdatePreset(p *Preset) error {
+	defer db.observe("UpdatePreset", time.Now())
+	return db.inTx(func(tx *sql.Tx) error {
+		_, e := tx.Exec(`
+UPDATE preset
+SET name=?, date_weight=?, view_weight=?, view_limit=?, type_answer=?, leech_threshold=?, leech_suspend=?
+WHERE preset_id=?`, p.Name, p.DateWeight, p.ViewWeight, p.ViewLimit, p.TypeAnswer, p.LeechThreshold,
+			p.LeechSuspend, p.ID)
+		if e != nil {
+			return e
+		}
+		return applyPreset(tx, `preset_id=?`, p.ID)
+	})
+}
+
+// DelPreset deletes the preset. Its decks keep the options they had from it.
+func (db *Database) DelPreset(presetID int) error {
+	defer db.observe("DelPreset", time.Now())
+	return db.inTx(func(tx *sql.Tx) error {
+		if _, e := tx.Exec(`UPDATE deck SET preset_id=NULL WHERE preset_id=?`, presetID); e != nil {
+			return e
+		}
+		_, e := tx.Exec(`DELETE FROM preset WHERE preset_id=?`, presetID)
+		return e
+	})
+}
+
+// GetDeckPreset returns the ID of the deck's preset, 0 if it has none, and the options the
+// deck overrides
+func (db *Database) GetDeckPreset(deckID int) (int, []string, error) {
+	defer db.observe("GetDeckPreset", time.Now())
+	var presetID sql.NullInt64
+	var overrides string
+	e := db.QueryRow(`SELECT preset_id, overrides FROM deck WHERE deck_id=?`, deckID).Scan(&presetID, &overrides)
+	if e != nil {
+		return 0, nil, e
+	}
+	if overrides == "" {
+		return int(presetID.Int64), nil, nil
+	}
+	return int(presetID.Int64), strings.Split(overrides, ","), nil
+}
+
+// SetDeckPreset links the deck to the preset, or unlinks it if presetID is 0, and applies
+// the preset's options other than overrides, which are from DeckOptions
+func (db *Database) SetDeckPreset(deckID, presetID int, overrides []string) error {
+	defer db.observe("SetDeckPreset", time.Now())
+	if e := db.CheckDeckPreset(presetID, overrides); e != nil {
+		return e
+	}
+	return db.inTx(func(tx *sql.Tx) error {
+		return setDeckPreset(tx, deckID, presetID, strings.Join(overrides, ","))
+	})
+}
+
+// CheckDeckPreset returns an error if SetDeckPreset would refuse the preset and overrides
+func (db *Database) CheckDeckPreset(presetID int, overrides []string) error {
+	valid := make(map[string]bool)
+	for _, option := range DeckOptions {
+		valid[option] = true
+	}
+	for _, option := range overrides {
+		if !valid[option] {
+			return fmt.Errorf("unknown deck option %q", option)
+		}
+	}
+	if presetID != 0 && db.GetPreset(presetID) == nil {
+		return fmt.Errorf("no preset with ID %d", presetID)
+	}
+	return nil
+}
+
+// setDeckPreset links the deck to the preset with overrides joined by commas, and applies
+// it
+func setDeckPreset(ex execer, deckID, presetID int, overrides string) error {
+	_, e := ex.Exec(`UPDATE deck SET preset_id=?, overrides=? WHERE deck_id=?`, nullInt(presetID), overrides, deckID)
+	if e != nil {
+		return e
+	}
+	return applyPreset(ex, `deck_id=?`, deckID)
+}
+
+// inTx runs fn in a transaction, committing it if fn succeeds
+func (db *Database) inTx(fn func(tx *sql.Tx) error) error {
+	tx, e := db.Begin()
+	if e != nil {
+		return e
+	}
+	if e := fn(tx); e != nil {
+		tx.Rollback()
+		return e
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,85 @@
+package carddb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPresets(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	preset, e := db.NewPreset("Languages")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if preset.ViewLimit != 1 || preset.LeechThreshold != DefaultLeechThreshold {
+		t.Errorf("got new preset: %+v", preset)
+	}
+
+	spanish, _ := db.NewDeck("Spanish")
+	french, _ := db.NewDeck("French")
+	other, _ := db.NewDeck("Other")
+	if e := db.SetDeckPreset(spanish.ID, preset.ID, nil); e != nil {
+		t.Fatal(e)
+	}
+	if e := db.SetDeckPreset(french.ID, preset.ID, []string{OptionViewLimit}); e != nil {
+		t.Fatal(e)
+	}
+
+	// French keeps its own view limit
+	french.ViewLimit = 3
+	db.UpdateDeck(french)
+	preset.ViewLimit = 10
+	preset.TypeAnswer = true
+	if e := db.UpdatePreset(preset); e != nil {
+		t.Fatal(e)
+	}
+	if got := db.GetDeck(spanish.ID); got.ViewLimit != 10 || !got.TypeAnswer {
+		t.Errorf("got linked deck: %+v", got)
+	}
+	if got := db.GetDeck(french.ID); got.ViewLimit != 3 || !got.TypeAnswer {
+		t.Errorf("got deck with an override: %+v", got)
+	}
+	if got := db.GetDeck(other.ID); got.ViewLimit != 1 || got.TypeAnswer {
+		t.Errorf("got unlinked deck: %+v", got)
+	}
+
+	// Editing a linked deck can't change the preset's options
+	spanish.ViewLimit = 2
+	db.UpdateDeck(spanish)
+	if got := db.GetDeck(spanish.ID); got.ViewLimit != 10 {
+		t.Errorf("got after editing linked deck: %+v", got)
+	}
+
+	presetID, overrides, e := db.GetDeckPreset(french.ID)
+	if e != nil || presetID != preset.ID || !reflect.DeepEqual(overrides, []string{OptionViewLimit}) {
+		t.Errorf("got deck preset: %d %v %v", presetID, overrides, e)
+	}
+	if presets, _ := db.GetPresets(); len(presets) != 1 || presets[0].Decks != 2 {
+		t.Errorf("got presets: %+v", presets)
+	}
+	if e := db.SetDeckPreset(other.ID, preset.ID, []string{"bogus"}); e == nil {
+		t.Error("set an unknown override")
+	}
+	if e := db.SetDeckPreset(other.ID, 1000, nil); e == nil {
+		t.Error("linked a missing preset")
+	}
+
+	// Deleting the preset unlinks its decks without changing them
+	if e := db.DelPreset(preset.ID); e != nil {
+		t.Fatal(e)
+	}
+	if presetID, _, _ := db.GetDeckPreset(spanish.ID); presetID != 0 {
+		t.Errorf("deck still linked to %d", presetID)
+	}
+	spanish = db.GetDeck(spanish.ID)
+	spanish.ViewLimit = 2
+	db.UpdateDeck(spanish)
+	if got := db.GetDeck(spanish.ID); got.ViewLimit != 2 || !got.TypeAnswer {
+		t.Errorf("got after deleting preset: %+v", got)
+	}
+}
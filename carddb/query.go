@@ -0,0 +1,169 @@
+package carddb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Card sort orders for CardQuery
+const (
+	SortCreated  = "created"
+	SortFront    = "front"
+	SortViews    = "views"
+	SortLastView = "last_view"
+	SortDue      = "due"
+)
+
+// SortOrders lists the card sort orders in the order they're offered
+var SortOrders = []string{SortCreated, SortFront, SortViews, SortLastView, SortDue}
+
+// dueLimit is the view limit used to estimate when a card listed outside a deck is due:
+// that of the card's deck with the lowest limit, which makes it due soonest, or 1 if it's
+// in no deck
+const dueLimit = `COALESCE((
+  SELECT MIN(d.view_limit)
+  FROM deck_card dc
+  JOIN deck d USING (deck_id)
+  WHERE dc.card_id=card.card_id AND d.deleted IS NULL
+), 1)`
+
+// dueExpr is DueInterval in SQL as a julian day, with limit as the view limit. The shift
+// is capped at 2^9 days, past MaxDueDays, since SQLite's shifts of 64 or more give 0.
+func dueExpr(limit string) string {
+	return fmt.Sprintf(`
+CASE WHEN views <= 0 THEN julianday('now')
+ELSE julianday(last_view) + MIN(1 << MIN(MAX(MIN(views, %s), 1) - 1, 9), %d) END`, limit, MaxDueDays)
+}
+
+// CardQuery selects a page of cards for QueryCards
+type CardQuery struct {
+	// Deck is the deck the cards are in. As with GetCards, 0 is cards in no deck and < 0
+	// is all cards.
+	Deck int
+	// Sort is one of the Sort constants, SortCreated if empty. Cards are numbered in the
+	// order they're created so SortCreated is by ID. SortDue estimates the due date with
+	// DueInterval.
+	Sort string
+	Desc bool
+
+	// Filters, only cards matching all of the set ones are returned
+	NeverViewed bool
+	Suspended   bool
+	Leech       bool
+	Tag         string
+	// Search matches text anywhere in the front or back, ignoring case
+	Search string
+
+	// Limit is the most cards returned, all of them if <= 0. Offset is the number of
+	// matching cards skipped before them.
+	Limit  int
+	Offset int
+}
+
+// CardPage is a page of cards returned by QueryCards
+type CardPage struct {
+	Cards []*Card
+	// Total is the number of cards matching the query on all pages
+	Total int
+}
+
+// QueryCards returns the page of cards selected by q
+func (db *Database) QueryCards(q CardQuery) (*CardPage, error) {
+	defer db.observe("QueryCards", time.Now())
+	if q.Sort == "" {
+		q.Sort = SortCreated
+	}
+	if q.Limit <= 0 {
+		// No limit in SQLite
+		q.Limit = -1
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	from := `card`
+	where := []string{`card.deleted IS NULL`}
+	var args []interface{}
+	limit := dueLimit
+	if q.Deck > 0 {
+		from = `card JOIN deck_card USING (card_id) JOIN deck USING (deck_id)`
+		where = append(where, `deck_id=?`)
+		args = append(args, q.Deck)
+		limit = `deck.view_limit`
+	} else if q.Deck == 0 {
+		where = append(where, `card_id NOT IN (
+  SELECT DISTINCT card_id
+  FROM deck_card
+  JOIN deck USING (deck_id)
+  WHERE deck.deleted IS NULL
+)`)
+	}
+	if q.NeverViewed {
+		where = append(where, `views=0`)
+	}
+	if q.Suspended {
+		where = append(where, `suspended=1`)
+	}
+	if q.Leech {
+		where = append(where, `leech=1`)
+	}
+	if tag := NormalizeTag(q.Tag); tag != "" {
+		where = append(where, `card_id IN (SELECT card_id FROM card_tag WHERE tag=?)`)
+		args = append(args, tag)
+	}
+	if q.Search != "" {
+		// Escape LIKE's wildcards so they match themselves
+		like := "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q.Search) + "%"
+		where = append(where, `(front LIKE ? ESCAPE '\' OR back LIKE ? ESCAPE '\')`)
+		args = append(args, like, like)
+	}
+
+	var order string
+	switch q.Sort {
+	case SortCreated:
+		order = `card_id`
+	case SortFront:
+		order = `front COLLATE NOCASE`
+	case SortViews:
+		order = `views`
+	case SortLastView:
+		order = `last_view`
+	case SortDue:
+		order = dueExpr(limit)
+	default:
+		return nil, fmt.Errorf("unknown sort order %q", q.Sort)
+	}
+	dir := ""
+	if q.Desc {
+		dir = " DESC"
+	}
+	// Ties are broken by ID so pages don't overlap
+	order = order + dir + ", card_id" + dir
+
+	cond := strings.Join(where, " AND ")
+	p := &CardPage{}
+	if e := db.QueryRow(`SELECT COUNT(*) FROM `+from+` WHERE `+cond, args...).Scan(&p.Total); e != nil {
+		return nil, e
+	}
+
+	rows, e := db.Query(`
+SELECT card_id, front, back, views, last_view, suspended, leech
+FROM `+from+`
+WHERE `+cond+`
+ORDER BY `+order+`
+LIMIT ? OFFSET ?`, append(args, q.Limit, q.Offset)...)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+	for rows.Next() {
+		c := &Card{}
+		if e := rows.Scan(&c.ID, &c.Front, &c.Back, &c.Views, &c.LastView, &c.Suspended, &c.Leech); e != nil {
+			return nil, e
+		}
+		c.LastView = c.LastView.Local()
+		p.Cards = append(p.Cards, c)
+	}
+	return p, rows.Err()
+}
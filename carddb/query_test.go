@@ -0,0 +1,107 @@
+package carddb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueryCards(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, _ := db.NewDeck("Deck")
+	deck.ViewLimit = 5
+	db.UpdateDeck(deck)
+
+	// Due: c (never viewed) now, a in 1 day, d in 6 days, b in 8 days
+	now := time.Now()
+	newCard := func(front string, views int, lastView time.Time, inDeck bool) int {
+		c, _ := db.NewCard()
+		c.Front = front
+		c.Back = "back of " + front
+		c.Views = views
+		c.LastView = lastView
+		db.UpdateCard(c)
+		if inDeck {
+			db.AddCardToDeck(c.ID, deck.ID)
+		}
+		return c.ID
+	}
+	b := newCard("b", 4, now.Add(-time.Hour), true)
+	a := newCard("A", 1, now, true)
+	c := newCard("c", 0, time.Time{}, true)
+	d := newCard("d_100%", 3, now.Add(2*24*time.Hour), false)
+
+	query := func(q CardQuery) []int {
+		t.Helper()
+		p, e := db.QueryCards(q)
+		if e != nil {
+			t.Fatal(e)
+		}
+		var ids []int
+		for _, c := range p.Cards {
+			ids = append(ids, c.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name string
+		q    CardQuery
+		want []int
+	}{
+		{"created", CardQuery{Deck: -1}, []int{b, a, c, d}},
+		{"created desc", CardQuery{Deck: -1, Sort: SortCreated, Desc: true}, []int{d, c, a, b}},
+		{"front", CardQuery{Deck: -1, Sort: SortFront}, []int{a, b, c, d}},
+		{"views", CardQuery{Deck: -1, Sort: SortViews}, []int{c, a, d, b}},
+		{"last view", CardQuery{Deck: -1, Sort: SortLastView, Desc: true}, []int{d, a, b, c}},
+		{"due", CardQuery{Deck: -1, Sort: SortDue}, []int{c, a, d, b}},
+		{"deck", CardQuery{Deck: deck.ID, Sort: SortDue}, []int{c, a, b}},
+		{"no deck", CardQuery{Deck: 0}, []int{d}},
+		{"never viewed", CardQuery{Deck: -1, NeverViewed: true}, []int{c}},
+		{"search", CardQuery{Deck: -1, Search: "BACK OF b"}, []int{b}},
+		{"search wildcards", CardQuery{Deck: -1, Search: "_100%"}, []int{d}},
+		{"page", CardQuery{Deck: -1, Limit: 2, Offset: 1}, []int{a, c}},
+	}
+	for _, test := range tests {
+		if got := query(test.q); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v want %v", test.name, got, test.want)
+		}
+	}
+
+	db.Bulk([]int{a, d}, BulkAction{Action: BulkTag, Tag: "tagged"})
+	db.Bulk([]int{a}, BulkAction{Action: BulkSuspend})
+	if got := query(CardQuery{Deck: -1, Tag: "Tagged", Suspended: true}); !reflect.DeepEqual(got, []int{a}) {
+		t.Errorf("got tagged and suspended: %v", got)
+	}
+
+	p, e := db.QueryCards(CardQuery{Deck: -1, Limit: 3, Offset: 3})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if p.Total != 4 || len(p.Cards) != 1 {
+		t.Errorf("got last page: %d cards of %d", len(p.Cards), p.Total)
+	}
+
+	db.DelCard(b)
+	if got := query(CardQuery{Deck: deck.ID}); !reflect.DeepEqual(got, []int{a, c}) {
+		t.Errorf("got with a card in the trash: %v", got)
+	}
+
+	// Past MaxDueDays the interval stops doubling instead of overflowing, so a card with 64
+	// views last seen 100 days ago is due after ones seen recently
+	deck.ViewLimit = 100
+	db.UpdateDeck(deck)
+	old := newCard("old", 64, now.AddDate(0, 0, -100), true)
+	if got := query(CardQuery{Deck: deck.ID, Sort: SortDue}); !reflect.DeepEqual(got, []int{c, a, old}) {
+		t.Errorf("got due with many views: %v", got)
+	}
+
+	if _, e := db.QueryCards(CardQuery{Sort: "bogus"}); e == nil {
+		t.Error("bad sort succeeded")
+	}
+}
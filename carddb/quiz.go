@@ -0,0 +1,223 @@
+package carddb
+
+import (
+	"database/sql"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// QuizQuestion is a card with the answers to choose from, one of which is its back
+type QuizQuestion struct {
+	Card    *Card
+	Choices []string
+}
+
+// NewQuiz makes a multiple choice question for each of the cards, in random order. Each
+// has up to choices answers: the card's back and distractors from the other cards. tags
+// are the cards' tags, as returned by GetCardTags.
+func NewQuiz(cards []*Card, tags map[int][]string, choices int) []QuizQuestion {
+	qs := make([]QuizQuestion, len(cards))
+	for i, c := range cards {
+		options := append(Distractors(c, cards, tags, choices-1), c.Back)
+		rand.Shuffle(len(options), func(i, j int) { options[i], options[j] = options[j], options[i] })
+		qs[i] = QuizQuestion{c, options}
+	}
+	rand.Shuffle(len(qs), func(i, j int) { qs[i], qs[j] = qs[j], qs[i] })
+	return qs
+}
+
+// Distractors picks up to n wrong answers for card from the backs of the other cards,
+// preferring cards sharing more of its tags, then backs with a length similar to the
+// card's. Backs that are the same as the card's once normalized, or as each other, are
+// skipped.
+func Distractors(card *Card, cards []*Card, tags map[int][]string, n int) []string {
+	type candidate struct {
+		back   string
+		shared int
+	}
+	own := make(map[string]bool)
+	for _, tag := range tags[card.ID] {
+		own[tag] = true
+	}
+	seen := map[string]bool{NormalizeAnswer(card.Back): true}
+	var candidates []candidate
+	for _, c := range cards {
+		norm := NormalizeAnswer(c.Back)
+		if c.ID == card.ID || seen[norm] {
+			continue
+		}
+		seen[norm] = true
+		shared := 0
+		for _, tag := range tags[c.ID] {
+			if own[tag] {
+				shared++
+			}
+		}
+		candidates = append(candidates, candidate{c.Back, shared})
+	}
+
+	// Shuffle first so equally good answers are picked at random
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	want := utf8.RuneCountInString(card.Back)
+	lengthDiff := func(s string) float64 {
+		return math.Abs(float64(utf8.RuneCountInString(s) - want))
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].shared != candidates[j].shared {
+			return candidates[i].shared > candidates[j].shared
+		}
+		return lengthDiff(candidates[i].back) < lengthDiff(candidates[j].back)
+	})
+
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	backs := make([]string, len(candidates))
+	for i, c := range candidates {
+		backs[i] = c.back
+	}
+	return backs
+}
+
+// QuizAnswer is the answer given to one question of a quiz. The card's front and back are
+// copied so the result still makes sense if the card changes later.
+type QuizAnswer struct {
+	CardID  int
+	Front   string
+	Back    string
+	Chosen  string
+	Correct bool
+}
+
+// QuizResult is a finished quiz
+type QuizResult struct {
+	ID      int
+	DeckID  int
+	Time    time.Time
+	Correct int
+	Total   int
+	// Answers is only filled in by GetQuizResult
+	Answers []QuizAnswer
+}
+
+// Percent returns the score as a percentage
+func (r *QuizResult) Percent() float64 {
+	if r.Total == 0 {
+		return 0
+	}
+	return 100 * float64(r.Correct) / float64(r.Total)
+}
+
+// SaveQuizResult stores the result and sets its ID. Correct and Total are computed from
+// the answers and Time is set to now if it's zero.
+func (db *Database) SaveQuizResult(result *QuizResult) error {
+	defer db.observe("SaveQuizResult", time.Now())
+	if result.Time.IsZero() {
+		result.Time = time.Now()
+	}
+	result.Total = len(result.Answers)
+	result.Correct = 0
+	for _, a := range result.Answers {
+		if a.Correct {
+			result.Correct++
+		}
+	}
+
+	tx, e := db.Begin()
+	if e != nil {
+		return e
+	}
+
+	res, e := tx.Exec(`
+INSERT INTO quiz (deck_id, time, correct, total)
+VALUES (?, ?, ?, ?)`, result.DeckID, result.Time.UTC(), result.Correct, result.Total)
+	if e != nil {
+		tx.Rollback()
+		return e
+	}
+	id, e := res.LastInsertId()
+	if e != nil {
+		tx.Rollback()
+		return e
+	}
+
+	for _, a := range result.Answers {
+		if _, e := tx.Exec(`
+INSERT INTO quiz_answer (quiz_id, card_id, front, back, chosen, correct)
+VALUES (?, ?, ?, ?, ?, ?)`, id, a.CardID, a.Front, a.Back, a.Chosen, a.Correct); e != nil {
+			tx.Rollback()
+			return e
+		}
+	}
+
+	if e := tx.Commit(); e != nil {
+		return e
+	}
+	result.ID = int(id)
+	return nil
+}
+
+// GetQuizResult returns the quiz result with the given ID including its answers, or nil
+// if there is no such result
+func (db *Database) GetQuizResult(quizID int) (*QuizResult, error) {
+	defer db.observe("GetQuizResult", time.Now())
+	r := &QuizResult{}
+	e := db.QueryRow(`
+SELECT quiz_id, deck_id, time, correct, total
+FROM quiz WHERE quiz_id=?`, quizID).Scan(&r.ID, &r.DeckID, &r.Time, &r.Correct, &r.Total)
+	if e == sql.ErrNoRows {
+		return nil, nil
+	} else if e != nil {
+		return nil, e
+	}
+	r.Time = r.Time.Local()
+
+	rows, e := db.Query(`
+SELECT card_id, front, back, chosen, correct
+FROM quiz_answer
+WHERE quiz_id=?
+ORDER BY rowid`, quizID)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a := QuizAnswer{}
+		if e := rows.Scan(&a.CardID, &a.Front, &a.Back, &a.Chosen, &a.Correct); e != nil {
+			return nil, e
+		}
+		r.Answers = append(r.Answers, a)
+	}
+	return r, rows.Err()
+}
+
+// GetQuizResults returns the results of the quizzes taken on the given deck, newest
+// first, without their answers
+func (db *Database) GetQuizResults(deckID int) ([]*QuizResult, error) {
+	defer db.observe("GetQuizResults", time.Now())
+	rows, e := db.Query(`
+SELECT quiz_id, deck_id, time, correct, total
+FROM quiz
+WHERE deck_id=?
+ORDER BY time DESC, quiz_id DESC`, deckID)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+
+	var rs []*QuizResult
+	for rows.Next() {
+		r := &QuizResult{}
+		if e := rows.Scan(&r.ID, &r.DeckID, &r.Time, &r.Correct, &r.Total); e != nil {
+			return nil, e
+		}
+		r.Time = r.Time.Local()
+		rs = append(rs, r)
+	}
+	return rs, rows.Err()
+}
@@ -0,0 +1,90 @@
+package carddb
+
+import (
+	"testing"
+)
+
+func TestDistractors(t *testing.T) {
+	card := &Card{ID: 1, Back: "four"}
+	cards := []*Card{
+		card,
+		{ID: 2, Back: "a much longer answer"},
+		{ID: 3, Back: "five"},
+		{ID: 4, Back: "Four!"},
+		{ID: 5, Back: "sixty"},
+		{ID: 6, Back: "five"},
+	}
+
+	got := Distractors(card, cards, nil, 2)
+	if len(got) != 2 || got[0] != "five" || got[1] != "sixty" {
+		t.Errorf("got: %q", got)
+	}
+
+	if got := Distractors(card, cards, nil, 10); len(got) != 3 {
+		t.Errorf("got: %q", got)
+	}
+
+	// Shared tags count for more than length
+	tags := map[int][]string{1: {"numbers", "words"}, 2: {"numbers", "words"}, 5: {"numbers"}}
+	got = Distractors(card, cards, tags, 2)
+	if len(got) != 2 || got[0] != "a much longer answer" || got[1] != "sixty" {
+		t.Errorf("with tags got: %q", got)
+	}
+}
+
+func TestNewQuiz(t *testing.T) {
+	cards := []*Card{{ID: 1, Back: "a"}, {ID: 2, Back: "b"}, {ID: 3, Back: "c"}}
+	qs := NewQuiz(cards, nil, 2)
+	if len(qs) != len(cards) {
+		t.Fatalf("got %d questions", len(qs))
+	}
+	for _, q := range qs {
+		found := false
+		for _, c := range q.Choices {
+			found = found || c == q.Card.Back
+		}
+		if len(q.Choices) != 2 || !found {
+			t.Errorf("card %d choices: %q", q.Card.ID, q.Choices)
+		}
+	}
+}
+
+func TestQuizResults(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, _ := db.NewDeck("Deck")
+	result := &QuizResult{DeckID: deck.ID, Answers: []QuizAnswer{
+		{CardID: 1, Front: "1+1", Back: "2", Chosen: "2", Correct: true},
+		{CardID: 2, Front: "2+2", Back: "4", Chosen: "5"},
+	}}
+	if e := db.SaveQuizResult(result); e != nil {
+		t.Fatal(e)
+	}
+	if result.ID == 0 || result.Correct != 1 || result.Total != 2 || result.Percent() != 50 {
+		t.Errorf("saved: %#v", result)
+	}
+
+	got, e := db.GetQuizResult(result.ID)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got == nil || len(got.Answers) != 2 || got.Answers[1].Chosen != "5" || got.Answers[0].Correct != true {
+		t.Errorf("got: %#v", got)
+	}
+
+	if got, e := db.GetQuizResult(result.ID + 1); got != nil || e != nil {
+		t.Errorf("missing result got: %#v, %v", got, e)
+	}
+
+	list, e := db.GetQuizResults(deck.ID)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(list) != 1 || list[0].ID != result.ID || list[0].Answers != nil {
+		t.Errorf("list: %#v", list)
+	}
+}
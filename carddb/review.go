@@ -0,0 +1,125 @@
+package carddb
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Grades recorded in a card's review history
+const (
+	// GradeCorrect is a typed answer that matched the back of the card
+	GradeCorrect = "correct"
+	// GradeIncorrect is a typed answer that didn't match the back of the card
+	GradeIncorrect = "incorrect"
+	// GradeGood is a card that was shown and not asked for again
+	GradeGood = "good"
+	// GradeAgain is a card that was shown and asked for again
+	GradeAgain = "again"
+)
+
+// Passed returns true if grade is one that counts the card as remembered
+func Passed(grade string) bool {
+	return grade == GradeCorrect || grade == GradeGood
+}
+
+// Review is an entry in a card's study history
+type Review struct {
+	ID     int
+	CardID int
+	DeckID int
+	Time   time.Time
+	Grade  string
+	// Answer is what was typed, if the deck asks for typed answers
+	Answer string
+	// Duration is how long it took to answer, 0 if unknown
+	Duration time.Duration
+}
+
+// AddReview adds review to the history of its card and sets its ID. If review.Time is
+// zero it's set to now.
+func (db *Database) AddReview(review *Review) error {
+	defer db.observe("AddReview", time.Now())
+	return addReview(db, review)
+}
+
+func addReview(ex execer, review *Review) error {
+	if review.Time.IsZero() {
+		review.Time = time.Now()
+	}
+
+	res, e := ex.Exec(`
+INSERT INTO review (card_id, deck_id, time, grade, answer, duration)
+VALUES (?, ?, ?, ?, ?, ?)`, review.CardID, review.DeckID, review.Time.UTC(), review.Grade, review.Answer,
+		review.Duration.Milliseconds())
+	if e != nil {
+		return e
+	}
+
+	id, e := res.LastInsertId()
+	review.ID = int(id)
+	return e
+}
+
+// UpdateReview changes the grade, answer and duration of the given review to match its
+// fields
+func (db *Database) UpdateReview(review *Review) error {
+	defer db.observe("UpdateReview", time.Now())
+	_, e := db.Exec(`
+UPDATE review
+SET grade=?, answer=?, duration=?
+WHERE review_id=?`, review.Grade, review.Answer, review.Duration.Milliseconds(), review.ID)
+	return e
+}
+
+// DelReview deletes the review with the given ID
+func (db *Database) DelReview(reviewID int) error {
+	defer db.observe("DelReview", time.Now())
+	_, e := db.Exec(`DELETE FROM review WHERE review_id=?`, reviewID)
+	return e
+}
+
+// GetReviews returns the review history of the card with the given ID, newest first
+func (db *Database) GetReviews(cardID int) ([]*Review, error) {
+	defer db.observe("GetReviews", time.Now())
+	rows, e := db.Query(`
+SELECT review_id, card_id, deck_id, time, grade, answer, duration
+FROM review
+WHERE card_id=?
+ORDER BY time DESC, review_id DESC`, cardID)
+	if e != nil {
+		return nil, e
+	}
+	return scanReviews(rows)
+}
+
+// GetDeckReviews returns the reviews made while studying the deck with the given ID since
+// the given time, oldest first. deckID < 0 returns reviews from all decks.
+func (db *Database) GetDeckReviews(deckID int, since time.Time) ([]*Review, error) {
+	defer db.observe("GetDeckReviews", time.Now())
+	rows, e := db.Query(`
+SELECT review_id, card_id, deck_id, time, grade, answer, duration
+FROM review
+WHERE (? < 0 OR deck_id=?) AND time >= ?
+ORDER BY time, review_id`, deckID, deckID, since.UTC())
+	if e != nil {
+		return nil, e
+	}
+	return scanReviews(rows)
+}
+
+func scanReviews(rows *sql.Rows) ([]*Review, error) {
+	defer rows.Close()
+
+	var rs []*Review
+	for rows.Next() {
+		r := &Review{}
+		var ms int64
+		if e := rows.Scan(&r.ID, &r.CardID, &r.DeckID, &r.Time, &r.Grade, &r.Answer, &ms); e != nil {
+			return nil, e
+		}
+		r.Time = r.Time.Local()
+		r.Duration = time.Duration(ms) * time.Millisecond
+		rs = append(rs, r)
+	}
+	return rs, rows.Err()
+}
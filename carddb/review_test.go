@@ -0,0 +1,38 @@
+package carddb
+
+import (
+	"testing"
+)
+
+func TestReviews(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	card, e := db.NewCard()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, e := db.NewDeck("Deck")
+	if e != nil {
+		t.Fatal(e)
+	}
+	first := &Review{CardID: card.ID, DeckID: deck.ID, Grade: GradeIncorrect, Answer: "wrong"}
+	second := &Review{CardID: card.ID, DeckID: deck.ID, Grade: GradeCorrect, Answer: "right"}
+	for _, r := range []*Review{first, second} {
+		if e := db.AddReview(r); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	got, e := db.GetReviews(card.ID)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(got) != 2 || got[0].ID != second.ID || got[1].Answer != "wrong" || got[1].Grade != GradeIncorrect {
+		t.Errorf("got: %#v", got)
+	}
+}
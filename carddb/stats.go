@@ -0,0 +1,325 @@
+package carddb
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+)
+
+// Card maturity, from how far a card's views are toward its deck's view limit
+const (
+	// MaturityNew cards have never been viewed
+	MaturityNew = "new"
+	// MaturityYoung cards have been viewed fewer times than the view limit
+	MaturityYoung = "young"
+	// MaturityMature cards have reached the view limit, so views no longer affect how
+	// often they're picked
+	MaturityMature = "mature"
+)
+
+// Maturity returns the maturity of a card in the given deck
+func Maturity(deck *Deck, card *Card) string {
+	switch {
+	case card.Views <= 0:
+		return MaturityNew
+	case card.Views >= deck.ViewLimit:
+		return MaturityMature
+	default:
+		return MaturityYoung
+	}
+}
+
+// MaxDueDays is the longest DueInterval, in days. Without it the doubling would overflow
+// for cards with many views.
+const MaxDueDays = 365
+
+// DueInterval is how long after it was last viewed a card counts as due when forecasting.
+// Cards are picked at random rather than scheduled, so this is only an estimate: new cards
+// are due now and the interval starts at a day, doubling with each view up to the deck's
+// view limit or MaxDueDays.
+func DueInterval(deck *Deck, card *Card) time.Duration {
+	if card.Views <= 0 {
+		return 0
+	}
+	views := card.Views
+	if views > deck.ViewLimit {
+		views = deck.ViewLimit
+	}
+	if views < 1 {
+		views = 1
+	}
+	days := math.Min(math.Pow(2, float64(views-1)), MaxDueDays)
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// DayCount is a count for a calendar day
+type DayCount struct {
+	// Day is midnight at the start of the day
+	Day   time.Time
+	Count int
+}
+
+// CardDifficulty is a card with how often it has been forgotten
+type CardDifficulty struct {
+	Card    *Card
+	Reviews int
+	Lapses  int
+}
+
+// LapseRate returns the fraction of reviews that weren't passed
+func (c CardDifficulty) LapseRate() float64 {
+	if c.Reviews == 0 {
+		return 0
+	}
+	return float64(c.Lapses) / float64(c.Reviews)
+}
+
+// Stats summarizes the cards and review history of a deck, or all decks
+type Stats struct {
+	Cards  int
+	New    int
+	Young  int
+	Mature int
+
+	// Reviews is the number of reviews ever made
+	Reviews int
+	// Retention is the fraction of reviews passed
+	Retention float64
+	// AvgAnswerTime is the mean time to answer over the reviews where it's known
+	AvgAnswerTime time.Duration
+
+	// ReviewsPerDay covers the last days days, oldest first, ending today
+	ReviewsPerDay []DayCount
+	// DueForecast covers the next days days starting today. Today includes overdue cards.
+	DueForecast []DayCount
+	// Hardest are the cards with the highest lapse rates, hardest first
+	Hardest []CardDifficulty
+}
+
+// RetentionPercent returns Retention as a percentage
+func (s *Stats) RetentionPercent() float64 {
+	return 100 * s.Retention
+}
+
+// HardestCount is the number of cards in Stats.Hardest
+var HardestCount = 10
+
+// startOfDay returns midnight at the start of t's day in loc
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// daysBetween returns the number of calendar days from the day starting at midnight day
+// to t's day
+func daysBetween(day, t time.Time) int {
+	// Round since days aren't always 24 hours long
+	return int(math.Round(startOfDay(t, day.Location()).Sub(day).Hours() / 24))
+}
+
+// DailyReviews returns the number of reviews made on each day from from's day to to's day
+// inclusive, oldest first, with days in loc. deckID < 0 counts reviews from all decks.
+func (db *Database) DailyReviews(deckID int, from, to time.Time, loc *time.Location) ([]DayCount, error) {
+	defer db.observe("DailyReviews", time.Now())
+	first := startOfDay(from, loc)
+	days := daysBetween(first, to) + 1
+	if days < 0 {
+		days = 0
+	}
+	counts := make([]DayCount, days)
+	for i := range counts {
+		counts[i].Day = first.AddDate(0, 0, i)
+	}
+
+	reviews, e := db.GetDeckReviews(deckID, first)
+	if e != nil {
+		return nil, e
+	}
+	for _, r := range reviews {
+		if day := daysBetween(first, r.Time); day >= 0 && day < days {
+			counts[day].Count++
+		}
+	}
+	return counts, nil
+}
+
+// Streak is a run of consecutive days with reviews
+type Streak struct {
+	// Current is the number of days in the run ending today, or yesterday if there are
+	// no reviews today yet
+	Current int
+	Longest int
+}
+
+// Streaks finds the streaks in counts, which must be consecutive days ending today
+func Streaks(counts []DayCount) Streak {
+	s := Streak{}
+	run := 0
+	for _, c := range counts {
+		if c.Count > 0 {
+			run++
+		} else {
+			run = 0
+		}
+		if run > s.Longest {
+			s.Longest = run
+		}
+	}
+
+	end := len(counts) - 1
+	if end >= 0 && counts[end].Count == 0 {
+		// Today isn't over yet
+		end--
+	}
+	for ; end >= 0 && counts[end].Count > 0; end-- {
+		s.Current++
+	}
+	return s
+}
+
+// GetStreak returns the study streaks over all reviews, with days in loc
+func (db *Database) GetStreak(loc *time.Location) (Streak, error) {
+	defer db.observe("GetStreak", time.Now())
+	var first time.Time
+	e := db.QueryRow(`SELECT time FROM review ORDER BY time LIMIT 1`).Scan(&first)
+	if e == sql.ErrNoRows {
+		return Streak{}, nil
+	} else if e != nil {
+		return Streak{}, e
+	}
+
+	counts, e := db.DailyReviews(-1, first, time.Now(), loc)
+	if e != nil {
+		return Streak{}, e
+	}
+	return Streaks(counts), nil
+}
+
+// GetStats computes stats for the deck with the given ID, or for all decks if deckID < 0.
+// The daily charts cover days days in loc.
+func (db *Database) GetStats(deckID int, days int, loc *time.Location) (*Stats, error) {
+	defer db.observe("GetStats", time.Now())
+	now := time.Now()
+	today := startOfDay(now, loc)
+
+	// Each card is classified by the first deck it's found in. Cards in no deck use the
+	// schema's default view limit.
+	var decks []*Deck
+	if deckID >= 0 {
+		deck := db.GetDeck(deckID)
+		if deck == nil {
+			return nil, nil
+		}
+		decks = []*Deck{deck}
+	} else {
+		var e error
+		if decks, e = db.GetDecks(-1); e != nil {
+			return nil, e
+		}
+		sort.Slice(decks, func(i, j int) bool { return decks[i].ID < decks[j].ID })
+		// ID 0 gets the cards in no deck
+		decks = append(decks, &Deck{ViewLimit: 1})
+	}
+
+	s := &Stats{}
+	var e error
+	if s.ReviewsPerDay, e = db.DailyReviews(deckID, today.AddDate(0, 0, 1-days), now, loc); e != nil {
+		return nil, e
+	}
+	for i := 0; i < days; i++ {
+		s.DueForecast = append(s.DueForecast, DayCount{Day: today.AddDate(0, 0, i)})
+	}
+
+	cards := make(map[int]*Card)
+	for _, deck := range decks {
+		deckCards, e := db.GetCards(deck.ID)
+		if e != nil {
+			return nil, e
+		}
+		for _, c := range deckCards {
+			if cards[c.ID] != nil {
+				continue
+			}
+			cards[c.ID] = c
+			s.Cards++
+			switch Maturity(deck, c) {
+			case MaturityNew:
+				s.New++
+			case MaturityYoung:
+				s.Young++
+			default:
+				s.Mature++
+			}
+
+			due := c.LastView.Add(DueInterval(deck, c))
+			if c.Views <= 0 {
+				due = now
+			}
+			day := daysBetween(today, due)
+			if day < 0 {
+				day = 0
+			}
+			if day < days {
+				s.DueForecast[day].Count++
+			}
+		}
+	}
+
+	reviews, e := db.GetDeckReviews(deckID, time.Time{})
+	if e != nil {
+		return nil, e
+	}
+	passed := 0
+	var answerTime time.Duration
+	timed := 0
+	difficulty := make(map[int]*CardDifficulty)
+	for _, r := range reviews {
+		s.Reviews++
+		if Passed(r.Grade) {
+			passed++
+		}
+		if r.Duration > 0 {
+			answerTime += r.Duration
+			timed++
+		}
+
+		if card := cards[r.CardID]; card != nil {
+			d := difficulty[r.CardID]
+			if d == nil {
+				d = &CardDifficulty{Card: card}
+				difficulty[r.CardID] = d
+			}
+			d.Reviews++
+			if !Passed(r.Grade) {
+				d.Lapses++
+			}
+		}
+	}
+	if s.Reviews > 0 {
+		s.Retention = float64(passed) / float64(s.Reviews)
+	}
+	if timed > 0 {
+		s.AvgAnswerTime = answerTime / time.Duration(timed)
+	}
+
+	for _, d := range difficulty {
+		if d.Lapses > 0 {
+			s.Hardest = append(s.Hardest, *d)
+		}
+	}
+	sort.Slice(s.Hardest, func(i, j int) bool {
+		a, b := s.Hardest[i], s.Hardest[j]
+		if a.LapseRate() != b.LapseRate() {
+			return a.LapseRate() > b.LapseRate()
+		}
+		if a.Lapses != b.Lapses {
+			return a.Lapses > b.Lapses
+		}
+		return a.Card.ID < b.Card.ID
+	})
+	if len(s.Hardest) > HardestCount {
+		s.Hardest = s.Hardest[:HardestCount]
+	}
+	return s, nil
+}
@@ -0,0 +1,228 @@
+package carddb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMaturityAndDue(t *testing.T) {
+	deck := &Deck{ViewLimit: 3}
+	tests := []struct {
+		views    int
+		maturity string
+		interval time.Duration
+	}{
+		{0, MaturityNew, 0},
+		{1, MaturityYoung, 24 * time.Hour},
+		{2, MaturityYoung, 48 * time.Hour},
+		{3, MaturityMature, 96 * time.Hour},
+		{10, MaturityMature, 96 * time.Hour},
+	}
+	for _, test := range tests {
+		card := &Card{Views: test.views}
+		if got := Maturity(deck, card); got != test.maturity {
+			t.Errorf("views %d maturity got: %s want: %s", test.views, got, test.maturity)
+		}
+		if got := DueInterval(deck, card); got != test.interval {
+			t.Errorf("views %d interval got: %v want: %v", test.views, got, test.interval)
+		}
+	}
+
+	// The doubling stops at MaxDueDays rather than overflowing
+	deck.ViewLimit = 100
+	for _, views := range []int{10, 18, 64, 100} {
+		if got, want := DueInterval(deck, &Card{Views: views}), MaxDueDays*24*time.Hour; got != want {
+			t.Errorf("views %d interval got: %v want: %v", views, got, want)
+		}
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, _ := db.NewDeck("Deck")
+	deck.ViewLimit = 2
+	if e := db.UpdateDeck(deck); e != nil {
+		t.Fatal(e)
+	}
+	var cards []*Card
+	for _, views := range []int{0, 1, 5} {
+		card, _ := db.NewCard()
+		card.Views = views
+		if views > 0 {
+			card.LastView = time.Now()
+		}
+		if e := db.UpdateCard(card); e != nil {
+			t.Fatal(e)
+		}
+		if e := db.AddCardToDeck(card.ID, deck.ID); e != nil {
+			t.Fatal(e)
+		}
+		cards = append(cards, card)
+	}
+	// Not in the deck
+	if _, e := db.NewCard(); e != nil {
+		t.Fatal(e)
+	}
+
+	other, _ := db.NewDeck("Other")
+	now := time.Now()
+	for _, r := range []*Review{
+		{CardID: cards[1].ID, DeckID: deck.ID, Grade: GradeGood, Duration: 2 * time.Second, Time: now},
+		{CardID: cards[1].ID, DeckID: deck.ID, Grade: GradeAgain, Duration: 4 * time.Second, Time: now},
+		{CardID: cards[2].ID, DeckID: deck.ID, Grade: GradeCorrect, Time: now.AddDate(0, 0, -1)},
+		{CardID: cards[2].ID, DeckID: other.ID, Grade: GradeIncorrect, Time: now},
+	} {
+		if e := db.AddReview(r); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	s, e := db.GetStats(deck.ID, 7, time.Local)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if s.Cards != 3 || s.New != 1 || s.Young != 1 || s.Mature != 1 {
+		t.Errorf("maturity: %+v", s)
+	}
+	if s.Reviews != 3 || s.Retention != 2.0/3 || s.AvgAnswerTime != 3*time.Second {
+		t.Errorf("reviews: %d retention: %v avg time: %v", s.Reviews, s.Retention, s.AvgAnswerTime)
+	}
+	if len(s.ReviewsPerDay) != 7 || s.ReviewsPerDay[6].Count != 2 || s.ReviewsPerDay[5].Count != 1 {
+		t.Errorf("per day: %+v", s.ReviewsPerDay)
+	}
+	// The new card is due today, the young one tomorrow and the mature one in 2 days
+	if len(s.DueForecast) != 7 || s.DueForecast[0].Count != 1 || s.DueForecast[1].Count != 1 ||
+		s.DueForecast[2].Count != 1 {
+		t.Errorf("forecast: %+v", s.DueForecast)
+	}
+	if len(s.Hardest) != 1 || s.Hardest[0].Card.ID != cards[1].ID || s.Hardest[0].LapseRate() != 0.5 {
+		t.Errorf("hardest: %+v", s.Hardest)
+	}
+
+	all, e := db.GetStats(-1, 7, time.Local)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if all.Cards != 4 || all.New != 2 || all.Reviews != 4 {
+		t.Errorf("all: %+v", all)
+	}
+
+	if s, e := db.GetStats(deck.ID+10, 7, time.Local); s != nil || e != nil {
+		t.Errorf("missing deck got: %v, %v", s, e)
+	}
+}
+
+func TestUpdateAndDelReview(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, _ := db.NewDeck("Deck")
+	card, _ := db.NewCard()
+	r := &Review{CardID: card.ID, DeckID: deck.ID, Grade: GradeGood}
+	if e := db.AddReview(r); e != nil {
+		t.Fatal(e)
+	}
+	r.Grade = GradeAgain
+	r.Duration = time.Second
+	if e := db.UpdateReview(r); e != nil {
+		t.Fatal(e)
+	}
+	got, e := db.GetReviews(card.ID)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(got) != 1 || got[0].Grade != GradeAgain || got[0].Duration != time.Second {
+		t.Errorf("got: %+v", got)
+	}
+
+	if e := db.DelReview(r.ID); e != nil {
+		t.Fatal(e)
+	}
+	if got, _ := db.GetReviews(card.ID); len(got) != 0 {
+		t.Errorf("got after delete: %+v", got)
+	}
+}
+
+func TestStreaks(t *testing.T) {
+	counts := func(cs ...int) []DayCount {
+		days := make([]DayCount, len(cs))
+		for i, c := range cs {
+			days[i].Count = c
+		}
+		return days
+	}
+	tests := []struct {
+		counts []DayCount
+		want   Streak
+	}{
+		{nil, Streak{}},
+		{counts(1, 1, 0, 1, 1, 1), Streak{Current: 3, Longest: 3}},
+		{counts(1, 1, 1, 0, 1, 0), Streak{Current: 1, Longest: 3}},
+		{counts(1, 0, 0), Streak{Current: 0, Longest: 1}},
+	}
+	for _, test := range tests {
+		if got := Streaks(test.counts); got != test.want {
+			t.Errorf("%v got: %+v want: %+v", test.counts, got, test.want)
+		}
+	}
+}
+
+func TestDailyReviews(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	if s, e := db.GetStreak(time.UTC); e != nil || s != (Streak{}) {
+		t.Errorf("no reviews got: %+v, %v", s, e)
+	}
+
+	// 23:30 UTC on the 1st is the 2nd in Tokyo
+	tokyo := time.FixedZone("Tokyo", 9*60*60)
+	first := time.Date(2020, 1, 1, 23, 30, 0, 0, time.UTC)
+	deck, _ := db.NewDeck("Deck")
+	card, _ := db.NewCard()
+	for _, tm := range []time.Time{first, first.Add(time.Hour), first.AddDate(0, 0, 2)} {
+		if e := db.AddReview(&Review{CardID: card.ID, DeckID: deck.ID, Grade: GradeGood, Time: tm}); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	check := func(loc *time.Location, want []int) {
+		t.Helper()
+		counts, e := db.DailyReviews(-1, first.AddDate(0, 0, -1), first.AddDate(0, 0, 3), loc)
+		if e != nil {
+			t.Fatal(e)
+		}
+		var got []int
+		for _, c := range counts {
+			if c.Day.Location() != loc || c.Day.Hour() != 0 {
+				t.Errorf("day %v isn't midnight in %v", c.Day, loc)
+			}
+			got = append(got, c.Count)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%v got: %v want: %v", loc, got, want)
+		}
+	}
+	check(time.UTC, []int{0, 1, 1, 1, 0})
+	check(tokyo, []int{0, 2, 0, 1, 0})
+
+	s, e := db.GetStreak(time.UTC)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if s.Longest != 3 || s.Current != 0 {
+		t.Errorf("streak got: %+v", s)
+	}
+}
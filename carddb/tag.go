@@ -0,0 +1,33 @@
+package carddb
+
+import (
+	"strings"
+	"time"
+)
+
+// NormalizeTag puts a tag in the form it's stored in: lower case with runs of white space
+// replaced by a single dash
+func NormalizeTag(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+}
+
+// GetCardTags returns the tags of every card that has any, sorted by tag
+func (db *Database) GetCardTags() (map[int][]string, error) {
+	defer db.observe("GetCardTags", time.Now())
+	rows, e := db.Query(`SELECT card_id, tag FROM card_tag ORDER BY tag`)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+
+	tags := make(map[int][]string)
+	for rows.Next() {
+		var id int
+		var tag string
+		if e := rows.Scan(&id, &tag); e != nil {
+			return nil, e
+		}
+		tags[id] = append(tags[id], tag)
+	}
+	return tags, rows.Err()
+}
@@ -0,0 +1,172 @@
+package carddb
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DefaultTrashRetention is how long deleted decks and cards are kept before PurgeTrash
+// removes them, unless configured otherwise
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashedDeck is a deck in the trash
+type TrashedDeck struct {
+	*Deck
+	Deleted time.Time
+	// Cards is the number of cards in the deck, including trashed ones
+	Cards int
+}
+
+// TrashedCard is a card in the trash
+type TrashedCard struct {
+	*Card
+	Deleted time.Time
+}
+
+// GetTrash returns the decks and cards in the trash, most recently deleted first
+func (db *Database) GetTrash() ([]*TrashedDeck, []*TrashedCard, error) {
+	defer db.observe("GetTrash", time.Now())
+	rows, e := db.Query(`
+SELECT deck_id, name, date_weight, view_weight, view_limit, type_answer, leech_threshold, leech_suspend, deleted,
+  (SELECT COUNT(*) FROM deck_card WHERE deck_card.deck_id=deck.deck_id)
+FROM deck
+WHERE deleted IS NOT NULL
+ORDER BY deleted DESC, deck_id`)
+	if e != nil {
+		return nil, nil, e
+	}
+	defer rows.Close()
+	var decks []*TrashedDeck
+	for rows.Next() {
+		d := &TrashedDeck{Deck: &Deck{}}
+		e := rows.Scan(&d.ID, &d.Name, &d.DateWeight, &d.ViewWeight, &d.ViewLimit, &d.TypeAnswer,
+			&d.LeechThreshold, &d.LeechSuspend, &d.Deleted, &d.Cards)
+		if e != nil {
+			return nil, nil, e
+		}
+		d.Deleted = d.Deleted.Local()
+		decks = append(decks, d)
+	}
+	if e := rows.Err(); e != nil {
+		return nil, nil, e
+	}
+
+	rows, e = db.Query(`
+SELECT card_id, front, back, views, last_view, suspended, leech, deleted
+FROM card
+WHERE deleted IS NOT NULL
+ORDER BY deleted DESC, card_id`)
+	if e != nil {
+		return nil, nil, e
+	}
+	defer rows.Close()
+	var cards []*TrashedCard
+	for rows.Next() {
+		c := &TrashedCard{Card: &Card{}}
+		e := rows.Scan(&c.ID, &c.Front, &c.Back, &c.Views, &c.LastView, &c.Suspended, &c.Leech, &c.Deleted)
+		if e != nil {
+			return nil, nil, e
+		}
+		c.LastView = c.LastView.Local()
+		c.Deleted = c.Deleted.Local()
+		cards = append(cards, c)
+	}
+	return decks, cards, rows.Err()
+}
+
+// restore takes the row with the given ID out of the trash
+func (db *Database) restore(table string, id int) error {
+	res, e := db.Exec(`UPDATE `+table+` SET deleted=NULL WHERE `+table+`_id=? AND deleted IS NOT NULL`, id)
+	if e != nil {
+		return e
+	}
+	if n, e := res.RowsAffected(); e != nil {
+		return e
+	} else if n == 0 {
+		return fmt.Errorf("no %s %d in the trash", table, id)
+	}
+	return nil
+}
+
+// RestoreDeck takes the deck out of the trash. It contains the same cards it did when it
+// was deleted.
+func (db *Database) RestoreDeck(deckID int) error {
+	defer db.observe("RestoreDeck", time.Now())
+	return db.restore("deck", deckID)
+}
+
+// RestoreCard takes the card out of the trash. It's in the same decks it was in when it
+// was deleted.
+func (db *Database) RestoreCard(cardID int) error {
+	defer db.observe("RestoreCard", time.Now())
+	return db.restore("card", cardID)
+}
+
+// purge permanently deletes the trashed rows of the table matching where, along with their
+// revisions, and returns how many there were. Their deck_card links and tags go with them
+// through their foreign keys.
+func purge(tx *sql.Tx, table, where string, args ...interface{}) (int, error) {
+	id := table + "_id"
+	_, e := tx.Exec(`
+DELETE FROM revision
+WHERE kind=? AND item_id IN (SELECT `+id+` FROM `+table+` WHERE deleted IS NOT NULL AND `+where+`)`,
+		append([]interface{}{table}, args...)...)
+	if e != nil {
+		return 0, e
+	}
+	res, e := tx.Exec(`DELETE FROM `+table+` WHERE deleted IS NOT NULL AND `+where, args...)
+	if e != nil {
+		return 0, e
+	}
+	n, e := res.RowsAffected()
+	return int(n), e
+}
+
+// purgeTx runs purge for each table in a transaction
+func (db *Database) purgeTx(tables []string, where string, args ...interface{}) ([]int, error) {
+	tx, e := db.Begin()
+	if e != nil {
+		return nil, e
+	}
+	counts := make([]int, len(tables))
+	for i, table := range tables {
+		if counts[i], e = purge(tx, table, where, args...); e != nil {
+			tx.Rollback()
+			return nil, e
+		}
+	}
+	return counts, tx.Commit()
+}
+
+// PurgeDeck permanently deletes the deck, which must be in the trash. Its cards are kept.
+func (db *Database) PurgeDeck(deckID int) error {
+	defer db.observe("PurgeDeck", time.Now())
+	counts, e := db.purgeTx([]string{"deck"}, "deck_id=?", deckID)
+	if e == nil && counts[0] == 0 {
+		e = fmt.Errorf("no deck %d in the trash", deckID)
+	}
+	return e
+}
+
+// PurgeCard permanently deletes the card, which must be in the trash. Its review history
+// is kept for stats.
+func (db *Database) PurgeCard(cardID int) error {
+	defer db.observe("PurgeCard", time.Now())
+	counts, e := db.purgeTx([]string{"card"}, "card_id=?", cardID)
+	if e == nil && counts[0] == 0 {
+		e = fmt.Errorf("no card %d in the trash", cardID)
+	}
+	return e
+}
+
+// PurgeTrash permanently deletes the decks and cards that were moved to the trash before
+// the given time and returns how many of each there were
+func (db *Database) PurgeTrash(before time.Time) (decks, cards int, e error) {
+	defer db.observe("PurgeTrash", time.Now())
+	counts, e := db.purgeTx([]string{"deck", "card"}, "deleted<?", before.UTC())
+	if e != nil {
+		return 0, 0, e
+	}
+	return counts[0], counts[1], nil
+}
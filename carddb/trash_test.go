@@ -0,0 +1,139 @@
+package carddb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, _ := db.NewDeck("Deck")
+	other, _ := db.NewDeck("Other")
+	card1, _ := db.NewCard()
+	card2, _ := db.NewCard()
+	for _, c := range []*Card{card1, card2} {
+		if e := db.AddCardToDeck(c.ID, deck.ID); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if e := db.AddCardToDeck(card1.ID, other.ID); e != nil {
+		t.Fatal(e)
+	}
+
+	if e := db.DelCard(card1.ID); e != nil {
+		t.Fatal(e)
+	}
+	if e := db.DelDeck(deck.ID); e != nil {
+		t.Fatal(e)
+	}
+
+	// Card 2's only deck is trashed, and Other's only card is
+	if cards, _ := db.GetCards(0); len(cards) != 1 || cards[0].ID != card2.ID {
+		t.Errorf("got no deck cards: %v", cards)
+	}
+	if decks, _ := db.GetDecks(0); len(decks) != 1 || decks[0].ID != other.ID {
+		t.Errorf("got empty decks: %v", decks)
+	}
+	if cards, _ := db.GetCards(deck.ID); len(cards) != 1 || cards[0].ID != card2.ID {
+		t.Errorf("got trashed deck's live cards: %v", cards)
+	}
+
+	decks, cards, e := db.GetTrash()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(decks) != 1 || decks[0].ID != deck.ID || decks[0].Cards != 2 || decks[0].Deleted.IsZero() {
+		t.Errorf("got trashed decks: %+v", decks)
+	}
+	if len(cards) != 1 || cards[0].ID != card1.ID || cards[0].Deleted.IsZero() {
+		t.Errorf("got trashed cards: %+v", cards)
+	}
+
+	// Restoring brings back the memberships
+	if e := db.RestoreDeck(deck.ID); e != nil {
+		t.Fatal(e)
+	}
+	if e := db.RestoreCard(card1.ID); e != nil {
+		t.Fatal(e)
+	}
+	if cards, _ := db.GetCards(deck.ID); len(cards) != 2 {
+		t.Errorf("got restored deck's cards: %v", cards)
+	}
+	if decks, _ := db.GetDecks(card1.ID); len(decks) != 2 {
+		t.Errorf("got restored card's decks: %v", decks)
+	}
+	if e := db.RestoreCard(card1.ID); e == nil {
+		t.Error("restored a card that isn't in the trash")
+	}
+	if e := db.PurgeCard(card1.ID); e == nil {
+		t.Error("purged a card that isn't in the trash")
+	}
+
+	// Only items deleted before the cutoff are purged
+	db.DelCard(card1.ID)
+	db.DelDeck(other.ID)
+	if n, m, e := db.PurgeTrash(time.Now().Add(-time.Hour)); e != nil || n != 0 || m != 0 {
+		t.Errorf("got: %d, %d, %v want: 0, 0, nil", n, m, e)
+	}
+	if n, m, e := db.PurgeTrash(time.Now().Add(time.Second)); e != nil || n != 1 || m != 1 {
+		t.Errorf("got: %d, %d, %v want: 1, 1, nil", n, m, e)
+	}
+	if e := db.RestoreCard(card1.ID); e == nil {
+		t.Error("restored a purged card")
+	}
+	var links int
+	db.QueryRow(`SELECT COUNT(*) FROM deck_card WHERE card_id=? OR deck_id=?`, card1.ID, other.ID).Scan(&links)
+	if links != 0 {
+		t.Errorf("got %d deck_card rows for purged items", links)
+	}
+
+	db.DelCard(card2.ID)
+	if e := db.PurgeCard(card2.ID); e != nil {
+		t.Fatal(e)
+	}
+	if decks, cards, _ := db.GetTrash(); len(decks) != 0 || len(cards) != 0 {
+		t.Errorf("got trash: %v %v", decks, cards)
+	}
+}
+
+func TestPurgeKeepsReviews(t *testing.T) {
+	db, e := OpenDatabase(testDB)
+	defer db.Close()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	deck, _ := db.NewDeck("Deck")
+	card, _ := db.NewCard()
+	if e := db.AddCardToDeck(card.ID, deck.ID); e != nil {
+		t.Fatal(e)
+	}
+	for _, days := range []int{0, 1} {
+		r := &Review{CardID: card.ID, DeckID: deck.ID, Grade: GradeGood, Time: time.Now().AddDate(0, 0, -days)}
+		if e := db.AddReview(r); e != nil {
+			t.Fatal(e)
+		}
+	}
+	reviews, _ := db.GetDeckReviews(deck.ID, time.Time{})
+	streak, _ := db.GetStreak(time.Local)
+	if len(reviews) != 2 || streak.Current != 2 {
+		t.Fatalf("got %d reviews and streak %+v before purging", len(reviews), streak)
+	}
+
+	db.DelCard(card.ID)
+	db.DelDeck(deck.ID)
+	if n, m, e := db.PurgeTrash(time.Now().Add(time.Second)); e != nil || n != 1 || m != 1 {
+		t.Fatalf("got: %d, %d, %v want: 1, 1, nil", n, m, e)
+	}
+	if got, e := db.GetDeckReviews(deck.ID, time.Time{}); e != nil || len(got) != len(reviews) {
+		t.Errorf("got reviews after purging: %v, %v", got, e)
+	}
+	if got, e := db.GetStreak(time.Local); e != nil || got != streak {
+		t.Errorf("got streak after purging: %+v, %v want: %+v", got, e, streak)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// snapshotDB takes a snapshot of the database in cfg.Backup.Dir every interval until ctx
+// is done, if snapshots are on
+func snapshotDB(ctx context.Context, interval time.Duration) {
+	if cfg.Backup.Dir == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if fileName, e := db.Snapshot(cfg.Backup.Dir, cfg.Backup.Keep); e != nil {
+			log.Println("Snapshotting database:", e)
+		} else {
+			log.Println("Snapshotted database to", fileName)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+func TestSnapshotDB(t *testing.T) {
+	startServer(t, defaultConfig(), nil)
+	cfg.Backup.Dir = t.TempDir()
+	cfg.Backup.Keep = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		snapshotDB(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		snapshots, e := carddb.Snapshots(cfg.Backup.Dir)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if len(snapshots) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got snapshots: %v", snapshots)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
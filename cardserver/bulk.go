@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+func cardBulkHandler(w http.ResponseWriter, r *http.Request) {
+	// Apply the posted action to the checked "cards". "from" is the deck they're listed in,
+	// if any.
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, urlFor("/card/"), http.StatusFound)
+		return
+	}
+	if e := r.ParseForm(); e != nil {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var cardIDs []int
+	for _, idStr := range r.PostForm["cards"] {
+		id, e := strconv.Atoi(idStr)
+		if e != nil {
+			http.Error(w, fmt.Sprintf("Bad card ID %q", idStr), http.StatusBadRequest)
+			return
+		}
+		cardIDs = append(cardIDs, id)
+	}
+	// Missing IDs are left 0, which Bulk rejects for the actions that need them
+	deckID, _ := strconv.Atoi(r.PostForm.Get("deck"))
+	fromID, _ := strconv.Atoi(r.PostForm.Get("from"))
+
+	action := carddb.BulkAction{
+		Action: r.PostForm.Get("action"),
+		Deck:   deckID,
+		From:   fromID,
+		Tag:    r.PostForm.Get("tag"),
+		Author: author(r),
+	}
+	if e := db.CheckBulk(action); e != nil {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	res, e := db.Bulk(cardIDs, action)
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+
+	back := urlFor("/card/")
+	if fromID != 0 {
+		back = urlFor(fmt.Sprintf("/deck/?d=%d", fromID))
+	}
+	if e := executeTemplate(w, "BulkResult", struct {
+		Result *carddb.BulkResult
+		Back   string
+	}{res, back}); e != nil {
+		internalError(w, e)
+		return
+	}
+}
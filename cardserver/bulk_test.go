@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCardBulk(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	from, _ := db.NewDeck("From")
+	to, _ := db.NewDeck("To")
+	var cards []string
+	for i := 0; i < 3; i++ {
+		card, _ := db.NewCard()
+		db.AddCardToDeck(card.ID, from.ID)
+		cards = append(cards, fmt.Sprint(card.ID))
+	}
+
+	body := postForm(t, base+"/card/bulk/", url.Values{
+		"cards":  cards[:2],
+		"action": {"move"},
+		"deck":   {fmt.Sprint(to.ID)},
+		"from":   {fmt.Sprint(from.ID)},
+	})
+	if !strings.Contains(body, "Moved 2 cards.") || !strings.Contains(body, fmt.Sprintf(`href="/deck/?d=%d"`, from.ID)) {
+		t.Errorf("got result page:\n%s", body)
+	}
+	if got, _ := db.GetCards(to.ID); len(got) != 2 {
+		t.Errorf("got %d cards in the new deck", len(got))
+	}
+
+	postForm(t, base+"/card/bulk/", url.Values{"cards": cards, "action": {"tag"}, "tag": {"Spanish"}})
+	body = get(t, fmt.Sprintf("%s/deck/?d=%d", base, to.ID))
+	if strings.Count(body, `<span class="tag">spanish</span>`) != 2 {
+		t.Errorf("tags not listed:\n%s", body)
+	}
+
+	for _, form := range []url.Values{
+		{"cards": cards, "action": {"move"}},
+		{"cards": cards, "action": {"move"}, "deck": {fmt.Sprint(to.ID)}, "from": {fmt.Sprint(to.ID)}},
+	} {
+		res, e := http.PostForm(base+"/card/bulk/", form)
+		if e != nil {
+			t.Fatal(e)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %s for %v", res.Status, form)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// cardsPerPage is how many cards are listed on each page of ShowDeck and ShowCard
+var cardsPerPage = 50
+
+// sortNames are the names of carddb.SortOrders shown in the list controls
+var sortNames = map[string]string{
+	carddb.SortCreated:  "Created",
+	carddb.SortFront:    "Front",
+	carddb.SortViews:    "Views",
+	carddb.SortLastView: "Last View",
+	carddb.SortDue:      "Due",
+}
+
+type sortOption struct {
+	Value, Name string
+}
+
+// cardList is the data for the card lists with bulk actions on ShowDeck and ShowCard
+type cardList struct {
+	// Deck is the deck being listed, nil for all cards
+	Deck  *carddb.Deck
+	Query carddb.CardQuery
+	Cards []*carddb.Card
+	// Total is the number of cards matching Query on all pages
+	Total int
+	Page  int
+	Pages int
+	Sorts []sortOption
+	// Decks are the decks cards can be moved or copied to
+	Decks []*carddb.Deck
+	Tags  map[int][]string
+
+	// path and params are the list page's URL without the page number
+	path   string
+	params url.Values
+}
+
+// PageURL returns the URL of the given page of the list
+func (l *cardList) PageURL(page int) string {
+	params := url.Values{}
+	for k, v := range l.params {
+		params[k] = v
+	}
+	params.Set("page", strconv.Itoa(page))
+	return urlFor(l.path) + "?" + params.Encode()
+}
+
+// PrevURL and NextURL return the URLs of the pages either side of this one, or "" if there
+// isn't one
+func (l *cardList) PrevURL() string {
+	if l.Page <= 1 {
+		return ""
+	}
+	return l.PageURL(l.Page - 1)
+}
+
+func (l *cardList) NextURL() string {
+	if l.Page >= l.Pages {
+		return ""
+	}
+	return l.PageURL(l.Page + 1)
+}
+
+// parseCardQuery reads the list controls from the form. Unknown sort orders are ignored.
+func parseCardQuery(r *http.Request, deck *carddb.Deck) (carddb.CardQuery, url.Values) {
+	q := carddb.CardQuery{
+		Deck:        -1,
+		Sort:        r.Form.Get("sort"),
+		Desc:        r.Form.Get("desc") != "",
+		NeverViewed: r.Form.Get("new") != "",
+		Suspended:   r.Form.Get("suspended") != "",
+		Leech:       r.Form.Get("leech") != "",
+		Tag:         r.Form.Get("tag"),
+		Search:      r.Form.Get("q"),
+	}
+	if _, ok := sortNames[q.Sort]; !ok {
+		q.Sort = carddb.SortCreated
+	}
+	if deck != nil {
+		q.Deck = deck.ID
+	} else if r.Form.Get("nodeck") != "" {
+		q.Deck = 0
+	}
+
+	params := url.Values{}
+	for _, k := range []string{"d", "sort", "desc", "new", "suspended", "leech", "nodeck", "tag", "q"} {
+		if v := r.Form.Get(k); v != "" {
+			params.Set(k, v)
+		}
+	}
+	return q, params
+}
+
+// getCardList gathers the data for the requested page of cards, which are those in deck or
+// all of them if deck is nil
+func getCardList(r *http.Request, deck *carddb.Deck) (*cardList, error) {
+	if e := r.ParseForm(); e != nil {
+		return nil, e
+	}
+	l := &cardList{Deck: deck, path: "/card/"}
+	if deck != nil {
+		l.path = "/deck/"
+	}
+	l.Query, l.params = parseCardQuery(r, deck)
+	for _, s := range carddb.SortOrders {
+		l.Sorts = append(l.Sorts, sortOption{s, sortNames[s]})
+	}
+
+	// Pages past the end show the last one. They're capped first so the offset can't
+	// overflow.
+	l.Page, _ = strconv.Atoi(r.Form.Get("page"))
+	if maxPage := math.MaxInt32 / cardsPerPage; l.Page > maxPage {
+		l.Page = maxPage
+	}
+	if l.Page < 1 {
+		l.Page = 1
+	}
+	l.Query.Limit = cardsPerPage
+	l.Query.Offset = (l.Page - 1) * cardsPerPage
+	page, e := db.QueryCards(l.Query)
+	if e != nil {
+		return nil, e
+	}
+	l.Total = page.Total
+	l.Pages = (l.Total + cardsPerPage - 1) / cardsPerPage
+	if l.Page > l.Pages && l.Pages > 0 {
+		l.Page = l.Pages
+		l.Query.Offset = (l.Page - 1) * cardsPerPage
+		if page, e = db.QueryCards(l.Query); e != nil {
+			return nil, e
+		}
+	}
+	l.Cards = page.Cards
+
+	if l.Decks, e = db.GetDecks(-1); e != nil {
+		return nil, e
+	}
+	sort.Sort(carddb.DecksByName(l.Decks))
+	if l.Tags, e = db.GetCardTags(); e != nil {
+		return nil, e
+	}
+	return l, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCardListPages(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+	defer func(n int) { cardsPerPage = n }(cardsPerPage)
+	cardsPerPage = 2
+
+	deck, _ := db.NewDeck("Deck")
+	for _, front := range []string{"b", "a", "c"} {
+		card, _ := db.NewCard()
+		card.Front = "front " + front
+		db.UpdateCard(card)
+		db.AddCardToDeck(card.ID, deck.ID)
+	}
+	loose, _ := db.NewCard()
+	loose.Front = "loose"
+	loose.Views = 1
+	db.UpdateCard(loose)
+
+	body := get(t, fmt.Sprintf("%s/deck/?d=%d&sort=front", base, deck.ID))
+	if !strings.Contains(body, "3 cards, page 1 of 2") ||
+		strings.Index(body, "front a") > strings.Index(body, "front b") || strings.Contains(body, "front c") {
+		t.Errorf("got first page:\n%s", body)
+	}
+	next := fmt.Sprintf(`href="/deck/?d=%d&amp;page=2&amp;sort=front"`, deck.ID)
+	if !strings.Contains(body, next) {
+		t.Errorf("no link to the next page %s:\n%s", next, body)
+	}
+	body = get(t, fmt.Sprintf("%s/deck/?d=%d&sort=front&page=2", base, deck.ID))
+	if !strings.Contains(body, "front c") || strings.Contains(body, "front a") || strings.Contains(body, ">Next<") {
+		t.Errorf("got second page:\n%s", body)
+	}
+
+	for _, page := range []string{"3", "9223372036854775807"} {
+		body = get(t, fmt.Sprintf("%s/deck/?d=%d&sort=front&page=%s", base, deck.ID, page))
+		if !strings.Contains(body, "3 cards, page 2 of 2") || !strings.Contains(body, "front c") {
+			t.Errorf("got page %s:\n%s", page, body)
+		}
+	}
+
+	body = get(t, base+"/card/?nodeck=1")
+	if !strings.Contains(body, "loose") || strings.Contains(body, "front a") || !strings.Contains(body, "1 card\n") {
+		t.Errorf("got cards in no deck:\n%s", body)
+	}
+	body = get(t, base+"/card/?new=1&sort=bogus")
+	if strings.Contains(body, "loose") || !strings.Contains(body, "3 cards") {
+		t.Errorf("got never viewed cards:\n%s", body)
+	}
+}
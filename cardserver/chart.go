@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// Chart sizes in pixels
+const (
+	chartWidth  = 600
+	chartHeight = 150
+	// chartPad leaves room for the axis labels
+	chartPad = 20
+)
+
+// barChart draws counts as an SVG bar chart, labelling every labelEvery'th day
+func barChart(counts []carddb.DayCount, labelEvery int) template.HTML {
+	max := 0
+	for _, c := range counts {
+		if c.Count > max {
+			max = c.Count
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	plotHeight := float64(chartHeight - 2*chartPad)
+	fmt.Fprintf(&b, `<text class="chart-label" x="0" y="%d">%d</text>`, chartPad-5, max)
+	fmt.Fprintf(&b, `<line class="chart-axis" x1="%d" y1="%d" x2="%d" y2="%d"/>`,
+		chartPad, chartHeight-chartPad, chartWidth, chartHeight-chartPad)
+
+	if len(counts) > 0 {
+		slot := float64(chartWidth-chartPad) / float64(len(counts))
+		for i, c := range counts {
+			x := float64(chartPad) + float64(i)*slot
+			h := 0.0
+			if max > 0 {
+				h = plotHeight * float64(c.Count) / float64(max)
+			}
+			day := c.Day.Format("Jan 2")
+			fmt.Fprintf(&b, `<rect class="chart-bar" x="%.1f" y="%.1f" width="%.1f" height="%.1f"><title>%s: %d</title></rect>`,
+				x+1, float64(chartHeight-chartPad)-h, slot-2, h, template.HTMLEscapeString(day), c.Count)
+			if labelEvery > 0 && i%labelEvery == 0 {
+				fmt.Fprintf(&b, `<text class="chart-label" x="%.1f" y="%d">%s</text>`,
+					x, chartHeight-5, template.HTMLEscapeString(day))
+			}
+		}
+	}
+
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// chartPart is a named share of a stackedChart
+type chartPart struct {
+	Name  string
+	Class string
+	Count int
+}
+
+// stackedChart draws the parts as an SVG bar divided in proportion to their counts, with
+// a legend
+func stackedChart(parts []chartPart) template.HTML {
+	total := 0
+	for _, p := range parts {
+		total += p.Count
+	}
+
+	const barHeight = 30
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		chartWidth, barHeight+chartPad, chartWidth, barHeight+chartPad)
+	x := 0.0
+	for i, p := range parts {
+		name := template.HTMLEscapeString(p.Name)
+		if total > 0 {
+			w := float64(chartWidth) * float64(p.Count) / float64(total)
+			fmt.Fprintf(&b, `<rect class="%s" x="%.1f" y="0" width="%.1f" height="%d"><title>%s: %d</title></rect>`,
+				template.HTMLEscapeString(p.Class), x, w, barHeight, name, p.Count)
+			x += w
+		}
+		fmt.Fprintf(&b, `<text class="chart-label %s" x="%d" y="%d">%s: %d</text>`,
+			template.HTMLEscapeString(p.Class), i*chartWidth/len(parts), barHeight+chartPad-5, name, p.Count)
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// Heatmap cell size and gap in pixels
+const (
+	heatCell = 11
+	heatGap  = 2
+)
+
+// heatmap draws counts as an SVG calendar with a column per week, like a contribution
+// graph. Cells are shaded in 4 levels relative to the busiest day.
+func heatmap(counts []carddb.DayCount) template.HTML {
+	max := 0
+	for _, c := range counts {
+		if c.Count > max {
+			max = c.Count
+		}
+	}
+	offset := 0
+	if len(counts) > 0 {
+		offset = int(counts[0].Day.Weekday())
+	}
+	weeks := (len(counts) + offset + 6) / 7
+	step := heatCell + heatGap
+
+	var b strings.Builder
+	width, height := chartPad+weeks*step, chartPad+7*step
+	fmt.Fprintf(&b, `<svg class="heatmap" xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		width, height, width, height)
+	for i, c := range counts {
+		week, weekday := (i+offset)/7, (i+offset)%7
+		x, y := chartPad+week*step, chartPad+weekday*step
+
+		// Label the first week of each month
+		if c.Day.Day() <= 7 && weekday == 0 {
+			fmt.Fprintf(&b, `<text class="chart-label" x="%d" y="%d">%s</text>`, x, chartPad-5, c.Day.Format("Jan"))
+		}
+
+		// Rounded up so any reviews show
+		level := 0
+		if max > 0 {
+			level = (4*c.Count + max - 1) / max
+		}
+		fmt.Fprintf(&b, `<rect class="heat-%d" x="%d" y="%d" width="%d" height="%d"><title>%s: %d</title></rect>`,
+			level, x, y, heatCell, heatCell, template.HTMLEscapeString(c.Day.Format("Mon Jan 2 2006")), c.Count)
+	}
+	for _, d := range []time.Weekday{time.Monday, time.Wednesday, time.Friday} {
+		fmt.Fprintf(&b, `<text class="chart-label" x="0" y="%d">%s</text>`,
+			chartPad+int(d)*step+heatCell-1, d.String()[:1])
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
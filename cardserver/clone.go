@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+func deckCloneHandler(w http.ResponseWriter, r *http.Request) {
+	// Ask for the new deck's name and what to carry over, then clone the deck and show the
+	// new one
+	form, e := parseForm(r)
+	if e != nil || form.Deck == nil {
+		if e != nil {
+			log.Println(e)
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		o := carddb.CloneOptions{
+			Name:      r.PostForm.Get("name"),
+			Deep:      r.PostForm.Get("mode") == "copy",
+			Preset:    r.PostForm.Get("preset") != "",
+			Stats:     r.PostForm.Get("stats") != "",
+			Suspended: r.PostForm.Get("suspended") != "",
+			Tags:      r.PostForm.Get("tags") != "",
+			Cards: carddb.CardQuery{
+				Leech:       r.PostForm.Get("onlyLeech") != "",
+				NeverViewed: r.PostForm.Get("onlyNew") != "",
+				Tag:         r.PostForm.Get("onlyTag"),
+			},
+		}
+		deck, e := db.CloneDeck(form.Deck.ID, o)
+		if e != nil {
+			http.Error(w, e.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, urlFor(fmt.Sprintf("/deck/?d=%d", deck.ID)), http.StatusFound)
+		return
+	}
+
+	if e := executeTemplate(w, "CloneDeck", form.Deck); e != nil {
+		internalError(w, e)
+		return
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDeckClone(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	deck, _ := db.NewDeck("Spanish")
+	card, _ := db.NewCard()
+	card.Front = "uno"
+	card.Views = 2
+	db.UpdateCard(card)
+	db.AddCardToDeck(card.ID, deck.ID)
+
+	cloneURL := fmt.Sprintf("%s/deck/clone/?d=%d", base, deck.ID)
+	if body := get(t, cloneURL); !strings.Contains(body, `value="Spanish (copy)"`) {
+		t.Errorf("got clone page:\n%s", body)
+	}
+
+	body := postForm(t, cloneURL, url.Values{"name": {"For Sam"}, "mode": {"copy"}})
+	if !strings.Contains(body, "<h1>For Sam</h1>") || !strings.Contains(body, "uno") {
+		t.Errorf("got new deck page:\n%s", body)
+	}
+	decks, _ := db.GetDecks(-1)
+	if len(decks) != 2 {
+		t.Fatalf("got decks: %v", decks)
+	}
+	for _, d := range decks {
+		if d.ID == deck.ID {
+			continue
+		}
+		cards, _ := db.GetCards(d.ID)
+		if len(cards) != 1 || cards[0].ID == card.ID || cards[0].Views != 0 {
+			t.Errorf("got copied cards: %+v", cards)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bredgren/cards/carddb"
+	"github.com/BurntSushi/toml"
+)
+
+// envPrefix is prepended to the upper case setting name to get its environment variable
+const envPrefix = "CARDS_"
+
+// config holds all server settings. Values are resolved with the precedence
+// flag > environment > config file > default.
+type config struct {
+	// Addr is the address to listen on, e.g. ":8081", "127.0.0.1:8081" or a Unix socket
+	// such as "unix:/run/cards.sock"
+	Addr string `toml:"addr"`
+	// TLSCert and TLSKey enable HTTPS when both are set. They are reloaded when changed.
+	TLSCert string `toml:"tls_cert"`
+	TLSKey  string `toml:"tls_key"`
+	// BasePath is the URL path the app is mounted at
+	BasePath string `toml:"base_path"`
+	// Static is the directory containing tmpl/ and static/, used in dev mode
+	Static string `toml:"static"`
+	Dev    bool   `toml:"dev"`
+	// SessionSecret is the key for signing session cookies. If set it must not be blank and
+	// must be at least minSecretLen bytes.
+	SessionSecret string `toml:"session_secret"`
+	// TimeZone is the IANA name of the zone days are counted in for stats and streaks, or
+	// "Local" for the server's
+	TimeZone string `toml:"time_zone"`
+	// TrashRetention is how long deleted decks and cards stay in the trash before they are
+	// permanently deleted. 0 keeps them until they are purged by hand.
+	TrashRetention time.Duration `toml:"trash_retention"`
+
+	// Timeouts for the HTTP server. ShutdownTimeout bounds how long in-flight requests
+	// are given to finish after SIGINT or SIGTERM.
+	ReadTimeout     time.Duration `toml:"read_timeout"`
+	WriteTimeout    time.Duration `toml:"write_timeout"`
+	IdleTimeout     time.Duration `toml:"idle_timeout"`
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout"`
+
+	DB     dbConfig     `toml:"db"`
+	Backup backupConfig `toml:"backup"`
+	Deck   deckDefaults `toml:"deck"`
+}
+
+// dbConfig holds the card database settings
+type dbConfig struct {
+	File         string `toml:"file"`
+	MaxOpenConns int    `toml:"max_open_conns"`
+}
+
+// backupConfig holds the settings for periodic snapshots of the database
+type backupConfig struct {
+	// Dir is where snapshots are written, snapshots are off if it's empty
+	Dir      string        `toml:"dir"`
+	Interval time.Duration `toml:"interval"`
+	// Keep is how many snapshots are kept, 0 for all of them
+	Keep int `toml:"keep"`
+}
+
+// deckDefaults are the values suggested when creating a new deck
+type deckDefaults struct {
+	DateWeight float64 `toml:"date_weight"`
+	ViewWeight float64 `toml:"view_weight"`
+	ViewLimit  int     `toml:"view_limit"`
+}
+
+const minSecretLen = 32
+
+func defaultConfig() config {
+	return config{
+		Addr:     ":8081",
+		BasePath: "/",
+		Static:   ".",
+		TimeZone: "Local",
+
+		TrashRetention: carddb.DefaultTrashRetention,
+
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		IdleTimeout:     2 * time.Minute,
+		ShutdownTimeout: 30 * time.Second,
+
+		DB: dbConfig{
+			File:         "cards.db",
+			MaxOpenConns: 0,
+		},
+		Backup: backupConfig{
+			Interval: 24 * time.Hour,
+			Keep:     7,
+		},
+		Deck: deckDefaults{
+			DateWeight: 1.0,
+			ViewWeight: 1.0,
+			ViewLimit:  20,
+		},
+	}
+}
+
+// setting ties a flag and an environment variable to a field of config
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	// set parses s and stores it in c
+	set func(c *config, s string) error
+	// get returns the current value of the field in c as a string
+	get    func(c *config) string
+	isBool bool
+}
+
+// flagValue records the raw value of a flag so it can be applied after the config file
+// and environment
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.value
+}
+
+func (v *flagValue) Set(s string) error {
+	v.value = s
+	return nil
+}
+
+// IsBoolFlag allows boolean settings to be given as just -name
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+func stringSetting(name, env, usage string, field func(c *config) *string) setting {
+	return setting{name, env, usage,
+		func(c *config, s string) error {
+			*field(c) = s
+			return nil
+		},
+		func(c *config) string { return *field(c) },
+		false,
+	}
+}
+
+func intSetting(name, env, usage string, field func(c *config) *int) setting {
+	return setting{name, env, usage,
+		func(c *config, s string) error {
+			i, e := strconv.Atoi(s)
+			if e != nil {
+				return e
+			}
+			*field(c) = i
+			return nil
+		},
+		func(c *config) string { return strconv.Itoa(*field(c)) },
+		false,
+	}
+}
+
+func floatSetting(name, env, usage string, field func(c *config) *float64) setting {
+	return setting{name, env, usage,
+		func(c *config, s string) error {
+			f, e := strconv.ParseFloat(s, 64)
+			if e != nil {
+				return e
+			}
+			*field(c) = f
+			return nil
+		},
+		func(c *config) string { return strconv.FormatFloat(*field(c), 'g', -1, 64) },
+		false,
+	}
+}
+
+func durationSetting(name, env, usage string, field func(c *config) *time.Duration) setting {
+	return setting{name, env, usage,
+		func(c *config, s string) error {
+			d, e := time.ParseDuration(s)
+			if e != nil {
+				return e
+			}
+			*field(c) = d
+			return nil
+		},
+		func(c *config) string { return field(c).String() },
+		false,
+	}
+}
+
+func boolSetting(name, env, usage string, field func(c *config) *bool) setting {
+	return setting{name, env, usage,
+		func(c *config, s string) error {
+			b, e := strconv.ParseBool(s)
+			if e != nil {
+				return e
+			}
+			*field(c) = b
+			return nil
+		},
+		func(c *config) string { return strconv.FormatBool(*field(c)) },
+		true,
+	}
+}
+
+var settings = []setting{
+	stringSetting("addr", "ADDR", "Address to listen on, host:port or unix:/path/to/socket",
+		func(c *config) *string { return &c.Addr }),
+	{"port", "PORT", "HTTP port, shorthand for -addr :<port>",
+		func(c *config, s string) error {
+			p, e := strconv.Atoi(s)
+			if e != nil {
+				return e
+			}
+			c.Addr = fmt.Sprintf(":%d", p)
+			return nil
+		},
+		func(c *config) string { return "" },
+		false,
+	},
+	stringSetting("tls-cert", "TLS_CERT", "TLS certificate file",
+		func(c *config) *string { return &c.TLSCert }),
+	stringSetting("tls-key", "TLS_KEY", "TLS key file",
+		func(c *config) *string { return &c.TLSKey }),
+	stringSetting("base", "BASE_PATH", "URL path the app is served under",
+		func(c *config) *string { return &c.BasePath }),
+	stringSetting("s", "STATIC", "Directory containing tmpl/ and static/, used in dev mode",
+		func(c *config) *string { return &c.Static }),
+	boolSetting("dev", "DEV", "Load templates and static files from disk on each request",
+		func(c *config) *bool { return &c.Dev }),
+	stringSetting("session-secret", "SESSION_SECRET", "Key for signing session cookies, at least 32 bytes",
+		func(c *config) *string { return &c.SessionSecret }),
+	stringSetting("tz", "TIME_ZONE", "Time zone days are counted in, e.g. America/Los_Angeles",
+		func(c *config) *string { return &c.TimeZone }),
+	durationSetting("trash-retention", "TRASH_RETENTION", "How long deleted items are kept in the trash, 0 for forever",
+		func(c *config) *time.Duration { return &c.TrashRetention }),
+	durationSetting("read-timeout", "READ_TIMEOUT", "Maximum time to read a request",
+		func(c *config) *time.Duration { return &c.ReadTimeout }),
+	durationSetting("write-timeout", "WRITE_TIMEOUT", "Maximum time to write a response",
+		func(c *config) *time.Duration { return &c.WriteTimeout }),
+	durationSetting("idle-timeout", "IDLE_TIMEOUT", "Maximum time to keep an idle connection open",
+		func(c *config) *time.Duration { return &c.IdleTimeout }),
+	durationSetting("shutdown-timeout", "SHUTDOWN_TIMEOUT", "Maximum time to wait for requests when shutting down",
+		func(c *config) *time.Duration { return &c.ShutdownTimeout }),
+	stringSetting("db", "DB_FILE", "SQL card database file",
+		func(c *config) *string { return &c.DB.File }),
+	intSetting("db-max-conns", "DB_MAX_OPEN_CONNS", "Maximum open database connections, 0 for unlimited",
+		func(c *config) *int { return &c.DB.MaxOpenConns }),
+	stringSetting("backup-dir", "BACKUP_DIR", "Directory to write periodic database snapshots to, empty for none",
+		func(c *config) *string { return &c.Backup.Dir }),
+	durationSetting("backup-interval", "BACKUP_INTERVAL", "Time between database snapshots",
+		func(c *config) *time.Duration { return &c.Backup.Interval }),
+	intSetting("backup-keep", "BACKUP_KEEP", "Number of database snapshots to keep, 0 for all",
+		func(c *config) *int { return &c.Backup.Keep }),
+	floatSetting("deck-date-weight", "DECK_DATE_WEIGHT", "Default date weight for new decks",
+		func(c *config) *float64 { return &c.Deck.DateWeight }),
+	floatSetting("deck-view-weight", "DECK_VIEW_WEIGHT", "Default view weight for new decks",
+		func(c *config) *float64 { return &c.Deck.ViewWeight }),
+	intSetting("deck-view-limit", "DECK_VIEW_LIMIT", "Default view limit for new decks",
+		func(c *config) *int { return &c.Deck.ViewLimit }),
+}
+
+// loadConfig resolves the configuration from the command line arguments, the environment
+// (through getenv) and the config file named by -config or CARDS_CONFIG.
+func loadConfig(args []string, getenv func(string) string) (config, error) {
+	c := defaultConfig()
+
+	fs := flag.NewFlagSet("cardserver", flag.ContinueOnError)
+	configFile := fs.String("config", getenv(envPrefix+"CONFIG"), "TOML config file")
+	flagValues := make(map[string]*flagValue, len(settings))
+	for _, s := range settings {
+		v := &flagValue{value: s.get(&c), isBool: s.isBool}
+		flagValues[s.flag] = v
+		fs.Var(v, s.flag, fmt.Sprintf("%s (env %s%s)", s.usage, envPrefix, s.env))
+	}
+	if e := fs.Parse(args); e != nil {
+		return c, e
+	}
+
+	if *configFile != "" {
+		md, e := toml.DecodeFile(*configFile, &c)
+		if e != nil {
+			return c, fmt.Errorf("config file %s: %v", *configFile, e)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return c, fmt.Errorf("config file %s: unknown keys %v", *configFile, undecoded)
+		}
+	}
+
+	for _, s := range settings {
+		if v := getenv(envPrefix + s.env); v != "" {
+			if e := s.set(&c, v); e != nil {
+				return c, fmt.Errorf("environment %s%s=%q: %v", envPrefix, s.env, v, e)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && flagErr == nil {
+				v := flagValues[s.flag].value
+				if e := s.set(&c, v); e != nil {
+					flagErr = fmt.Errorf("flag -%s=%q: %v", s.flag, v, e)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return c, flagErr
+	}
+
+	return c, c.validate()
+}
+
+// validate checks that the settings make sense together
+func (c *config) validate() error {
+	var errs []string
+	if c.Addr == "" || c.Addr == unixPrefix {
+		errs = append(errs, "addr must not be empty")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		errs = append(errs, "tls_cert and tls_key must be set together")
+	}
+	if !strings.HasPrefix(c.BasePath, "/") {
+		errs = append(errs, fmt.Sprintf("base_path %q must start with '/'", c.BasePath))
+	}
+	if c.SessionSecret != "" && strings.TrimSpace(c.SessionSecret) == "" {
+		errs = append(errs, "session_secret must not be blank")
+	} else if c.SessionSecret != "" && len(c.SessionSecret) < minSecretLen {
+		errs = append(errs, fmt.Sprintf("session_secret must be at least %d bytes", minSecretLen))
+	}
+	if _, e := time.LoadLocation(c.TimeZone); e != nil {
+		errs = append(errs, fmt.Sprintf("time_zone: %v", e))
+	}
+	if c.TrashRetention < 0 {
+		errs = append(errs, "trash_retention must not be negative")
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 || c.ShutdownTimeout < 0 {
+		errs = append(errs, "timeouts must not be negative")
+	}
+	if c.DB.File == "" {
+		errs = append(errs, "db.file must not be empty")
+	}
+	if c.Backup.Dir != "" && c.Backup.Interval <= 0 {
+		errs = append(errs, "backup.interval must be positive")
+	}
+	if c.Backup.Keep < 0 {
+		errs = append(errs, "backup.keep must not be negative")
+	}
+	if c.DB.MaxOpenConns < 0 {
+		errs = append(errs, "db.max_open_conns must not be negative")
+	}
+	if c.Deck.DateWeight < 0 || c.Deck.ViewWeight < 0 {
+		errs = append(errs, "deck weights must not be negative")
+	}
+	if c.Deck.ViewLimit < 0 {
+		errs = append(errs, "deck.view_limit must not be negative")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// location returns the time zone named by TimeZone, or the server's if it isn't valid
+func (c *config) location() *time.Location {
+	loc, e := time.LoadLocation(c.TimeZone)
+	if e != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// loadConfigOrExit is loadConfig for main, exiting with a message on failure
+func loadConfigOrExit() config {
+	c, e := loadConfig(os.Args[1:], os.Getenv)
+	if e == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(2)
+	}
+	return c
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func envMap(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func TestLoadConfigDefault(t *testing.T) {
+	got, e := loadConfig(nil, envMap(nil))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if want := defaultConfig(); got != want {
+		t.Errorf("got: %#v want: %#v", got, want)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cards.toml")
+	if e := os.WriteFile(file, []byte(`
+addr = "127.0.0.1:9000"
+base_path = "/file/"
+session_secret = "file-secret-file-secret-file-secret"
+
+[db]
+file = "file.db"
+
+[deck]
+view_limit = 5
+date_weight = 3.0
+`), 0644); e != nil {
+		t.Fatal(e)
+	}
+
+	env := envMap(map[string]string{
+		"CARDS_CONFIG":          file,
+		"CARDS_DB_FILE":         "env.db",
+		"CARDS_BASE_PATH":       "/env/",
+		"CARDS_DECK_VIEW_LIMIT": "7",
+		"CARDS_SESSION_SECRET":  "env-secret-env-secret-env-secret!",
+	})
+	got, e := loadConfig([]string{"-base", "/flag/", "-dev"}, env)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	want := defaultConfig()
+	want.Addr = "127.0.0.1:9000"
+	want.BasePath = "/flag/"
+	want.Dev = true
+	want.DB.File = "env.db"
+	want.Deck.ViewLimit = 7
+	want.Deck.DateWeight = 3.0
+	want.SessionSecret = "env-secret-env-secret-env-secret!"
+	if got != want {
+		t.Errorf("got: %#v want: %#v", got, want)
+	}
+}
+
+func TestLoadConfigPort(t *testing.T) {
+	got, e := loadConfig([]string{"-port", "1234"}, envMap(nil))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got.Addr != ":1234" {
+		t.Errorf("got: %q want: %q", got.Addr, ":1234")
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	cases := []struct {
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{[]string{"-tls-cert", "cert.pem"}, nil, "tls_cert and tls_key"},
+		{[]string{"-base", "cards"}, nil, "base_path"},
+		{[]string{"-session-secret", "short"}, nil, "session_secret"},
+		{[]string{"-session-secret", strings.Repeat(" ", 40)}, nil, "session_secret"},
+		{[]string{"-tz", "Nowhere/Special"}, nil, "time_zone"},
+		{[]string{"-trash-retention", "-1h"}, nil, "trash_retention"},
+		{[]string{"-backup-dir", "backups", "-backup-interval", "0s"}, nil, "backup.interval"},
+		{[]string{"-backup-keep", "-1"}, nil, "backup.keep"},
+		{nil, map[string]string{"CARDS_DECK_VIEW_LIMIT": "many"}, "CARDS_DECK_VIEW_LIMIT"},
+		{[]string{"-deck-view-weight", "-1"}, nil, "deck weights"},
+		{nil, map[string]string{"CARDS_CONFIG": "does-not-exist.toml"}, "config file"},
+	}
+	for _, c := range cases {
+		_, e := loadConfig(c.args, envMap(c.env))
+		if e == nil || !strings.Contains(e.Error(), c.want) {
+			t.Errorf("args %v env %v: got error %v, want one mentioning %q", c.args, c.env, e, c.want)
+		}
+	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	got, e := loadConfig([]string{"-config", "cards.example.toml"}, envMap(nil))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if want := defaultConfig(); got != want {
+		t.Errorf("got: %#v want: %#v", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// cardDecks returns the decks the card is in and the others it could be added to, both
+// sorted by name
+func cardDecks(cardID int) (decks, others []*carddb.Deck, e error) {
+	if decks, e = db.GetDecks(cardID); e != nil {
+		return nil, nil, e
+	}
+	all, e := db.GetDecks(-1)
+	if e != nil {
+		return nil, nil, e
+	}
+	for _, d := range all {
+		if !containsDeck(decks, d.ID) {
+			others = append(others, d)
+		}
+	}
+	sort.Sort(carddb.DecksByName(decks))
+	sort.Sort(carddb.DecksByName(others))
+	return decks, others, nil
+}
+
+func containsDeck(decks []*carddb.Deck, deckID int) bool {
+	for _, d := range decks {
+		if d.ID == deckID {
+			return true
+		}
+	}
+	return false
+}
+
+func cardDecksHandler(w http.ResponseWriter, r *http.Request) {
+	// Add the card to, or remove it from, a deck depending on "action" then go back to
+	// editing it
+	form, e := parseForm(r)
+	if e != nil || form.Card == nil || form.Deck == nil {
+		if e != nil {
+			log.Println(e)
+		}
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, urlFor(fmt.Sprintf("/card/edit/?c=%d", form.Card.ID)), http.StatusFound)
+		return
+	}
+
+	switch action := r.PostForm.Get("action"); action {
+	case "add":
+		// A card can only be in a deck once
+		var decks []*carddb.Deck
+		if decks, e = db.GetDecks(form.Card.ID); e == nil && !containsDeck(decks, form.Deck.ID) {
+			e = db.AddCardToDeck(form.Card.ID, form.Deck.ID)
+		}
+	case "remove":
+		e = db.DelCardFromDeck(form.Card.ID, form.Deck.ID)
+	default:
+		http.Error(w, fmt.Sprintf("Unknown action %q", action), http.StatusBadRequest)
+		return
+	}
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+	http.Redirect(w, r, urlFor(fmt.Sprintf("/card/edit/?c=%d", form.Card.ID)), http.StatusFound)
+}
+
+func orphansHandler(w http.ResponseWriter, r *http.Request) {
+	// List the cards in no deck and the decks with no cards
+	cards, e := db.GetCards(0)
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+	sort.Sort(carddb.CardsByID(cards))
+	decks, e := db.GetDecks(0)
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+	sort.Sort(carddb.DecksByName(decks))
+
+	if e := executeTemplate(w, "Orphans", struct {
+		Cards []*carddb.Card
+		Decks []*carddb.Deck
+	}{cards, decks}); e != nil {
+		internalError(w, e)
+		return
+	}
+}
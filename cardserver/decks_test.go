@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCardDecks(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	spanish, _ := db.NewDeck("Spanish")
+	verbs, _ := db.NewDeck("Verbs")
+	empty, _ := db.NewDeck("Empty")
+	card, _ := db.NewCard()
+	card.Front = "hablar"
+	db.UpdateCard(card)
+	db.AddCardToDeck(card.ID, spanish.ID)
+
+	editURL := fmt.Sprintf("%s/card/edit/?c=%d", base, card.ID)
+	body := get(t, editURL)
+	if !strings.Contains(body, fmt.Sprintf(`/card/decks/?c=%d&d=%d`, card.ID, spanish.ID)) ||
+		!strings.Contains(body, fmt.Sprintf(`<option value="%d">Verbs</option>`, verbs.ID)) {
+		t.Errorf("got edit page:\n%s", body)
+	}
+
+	decksURL := fmt.Sprintf("%s/card/decks/?c=%d", base, card.ID)
+	// Adding twice is the same as adding once
+	for i := 0; i < 2; i++ {
+		postForm(t, decksURL, url.Values{"d": {fmt.Sprint(verbs.ID)}, "action": {"add"}})
+	}
+	postForm(t, decksURL, url.Values{"d": {fmt.Sprint(spanish.ID)}, "action": {"remove"}})
+	if decks, _ := db.GetDecks(card.ID); len(decks) != 1 || decks[0].ID != verbs.ID {
+		t.Errorf("got decks: %v", decks)
+	}
+
+	postForm(t, decksURL, url.Values{"d": {fmt.Sprint(verbs.ID)}, "action": {"remove"}})
+	body = get(t, base+"/orphans/")
+	cards, decks := body[:strings.Index(body, "Empty Decks")], body[strings.Index(body, "Empty Decks"):]
+	if !strings.Contains(cards, "hablar") {
+		t.Errorf("orphaned card not listed:\n%s", body)
+	}
+	for _, d := range []string{spanish.Name, verbs.Name, empty.Name} {
+		if !strings.Contains(decks, d) {
+			t.Errorf("empty deck %s not listed:\n%s", d, body)
+		}
+	}
+}
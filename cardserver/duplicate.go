@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+func cardDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	// List groups of similar cards, "s" being how similar from 0 to 1. Posting "keep" and
+	// "cards" merges the cards into the kept one.
+	if e := r.ParseForm(); e != nil {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		keepID, e := strconv.Atoi(r.PostForm.Get("keep"))
+		if e != nil {
+			http.Error(w, "Pick a card to keep", http.StatusBadRequest)
+			return
+		}
+		var cardIDs []int
+		for _, idStr := range r.PostForm["cards"] {
+			id, e := strconv.Atoi(idStr)
+			if e != nil {
+				http.Error(w, fmt.Sprintf("Bad card ID %q", idStr), http.StatusBadRequest)
+				return
+			}
+			cardIDs = append(cardIDs, id)
+		}
+		if _, e := db.MergeCards(keepID, cardIDs, author(r)); e != nil {
+			http.Error(w, e.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, urlFor(fmt.Sprintf("/card/duplicates/?merged=%d", keepID)), http.StatusFound)
+		return
+	}
+
+	similarity := carddb.DefaultSimilarity
+	if s := r.Form.Get("s"); s != "" {
+		var e error
+		if similarity, e = strconv.ParseFloat(s, 64); e != nil || similarity < 0 || similarity > 1 {
+			http.Error(w, fmt.Sprintf("Bad similarity %q, it must be from 0 to 1", s), http.StatusBadRequest)
+			return
+		}
+	}
+	groups, e := db.FindDuplicates(similarity)
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+	merged, _ := strconv.Atoi(r.Form.Get("merged"))
+
+	if e := executeTemplate(w, "Duplicates", struct {
+		Similarity float64
+		Groups     [][]*carddb.Card
+		Merged     int
+	}{similarity, groups, merged}); e != nil {
+		internalError(w, e)
+		return
+	}
+}
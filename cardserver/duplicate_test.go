@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCardDuplicates(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	var ids []int
+	var cards []string
+	for _, front := range []string{"el perro", "El perro.", "el gato"} {
+		card, _ := db.NewCard()
+		card.Front = front
+		card.Back = "the dog"
+		db.UpdateCard(card)
+		ids = append(ids, card.ID)
+		cards = append(cards, fmt.Sprint(card.ID))
+	}
+
+	body := get(t, base+"/card/duplicates/")
+	if strings.Count(body, `name="keep"`) != 2 || strings.Contains(body, "el gato") {
+		t.Errorf("got duplicates:\n%s", body)
+	}
+	if body := get(t, base+"/card/duplicates/?s=0.1"); strings.Count(body, `name="keep"`) != 3 {
+		t.Errorf("got duplicates with a low similarity:\n%s", body)
+	}
+
+	body = postForm(t, base+"/card/duplicates/", url.Values{"keep": {cards[1]}, "cards": cards[:2]})
+	if !strings.Contains(body, "Merged the cards into") || !strings.Contains(body, "No duplicates found") {
+		t.Errorf("got after merging:\n%s", body)
+	}
+	if db.GetCard(ids[0]) != nil || db.GetCard(ids[1]) == nil {
+		t.Error("wrong card kept")
+	}
+}
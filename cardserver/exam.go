@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// Defaults for the new exam form
+const (
+	examCards   = 20
+	examMinutes = 10
+)
+
+func examNewHandler(w http.ResponseWriter, r *http.Request) {
+	// Show a form for picking the decks, size and time limit of an exam, and start it
+	if r.Method == http.MethodPost {
+		if e := r.ParseForm(); e != nil {
+			http.Error(w, e.Error(), http.StatusBadRequest)
+			return
+		}
+		var deckIDs []int
+		for _, idStr := range r.PostForm["decks"] {
+			id, e := strconv.Atoi(idStr)
+			if e != nil {
+				http.Error(w, fmt.Sprintf("Bad deck ID %q", idStr), http.StatusBadRequest)
+				return
+			}
+			deckIDs = append(deckIDs, id)
+		}
+		n, e := strconv.Atoi(r.PostForm.Get("cards"))
+		if e != nil {
+			http.Error(w, "Bad number of cards", http.StatusBadRequest)
+			return
+		}
+		// NaN, infinite and too long limits can't be made into a duration
+		minutes, e := strconv.ParseFloat(r.PostForm.Get("minutes"), 64)
+		if e != nil || !(minutes > 0 && minutes < math.MaxInt64/float64(time.Minute)) {
+			http.Error(w, "Bad time limit", http.StatusBadRequest)
+			return
+		}
+
+		exam, e := db.NewExam(deckIDs, n, time.Duration(minutes*float64(time.Minute)))
+		if e != nil {
+			http.Error(w, e.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, urlFor(fmt.Sprintf("/exam/?e=%d", exam.ID)), http.StatusFound)
+		return
+	}
+
+	decks, e := db.GetDecks(-1)
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+	sort.Sort(carddb.DecksByName(decks))
+
+	if e := executeTemplate(w, "NewExam", struct {
+		Decks   []*carddb.Deck
+		Cards   int
+		Minutes int
+	}{decks, examCards, examMinutes}); e != nil {
+		internalError(w, e)
+		return
+	}
+}
+
+// getExam returns the exam given by the "e" form value, or nil if there isn't one
+func getExam(r *http.Request) (*carddb.Exam, error) {
+	examID, e := strconv.Atoi(r.FormValue("e"))
+	if e != nil {
+		return nil, nil
+	}
+	return db.GetExam(examID)
+}
+
+func examHandler(w http.ResponseWriter, r *http.Request) {
+	// List exams, or show the given one: the questions while it's running and the report
+	// once it's finished. POST hands in the answers.
+	if r.FormValue("e") == "" {
+		exams, e := db.GetExams()
+		if e != nil {
+			internalError(w, e)
+			return
+		}
+		if e := executeTemplate(w, "Exams", struct {
+			Exams []*carddb.Exam
+		}{exams}); e != nil {
+			internalError(w, e)
+		}
+		return
+	}
+
+	exam, e := getExam(r)
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+	if exam == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !exam.Done() {
+		// Answers are only looked at when the exam is handed in on time, so finishing an
+		// abandoned exam with none is the same as it being handed in late
+		late := time.Now().After(exam.Deadline().Add(carddb.ExamGrace))
+		if r.Method == http.MethodPost || late {
+			answers := make(map[int]string)
+			for _, c := range exam.Cards {
+				answers[c.CardID] = r.PostFormValue(fmt.Sprintf("a%d", c.CardID))
+			}
+			if e := db.FinishExam(exam, answers); e != nil {
+				internalError(w, e)
+				return
+			}
+			http.Redirect(w, r, urlFor(fmt.Sprintf("/exam/?e=%d", exam.ID)), http.StatusFound)
+			return
+		}
+
+		if e := executeTemplate(w, "TakeExam", struct {
+			Exam *carddb.Exam
+			// Deadline is in milliseconds since the epoch, for the countdown
+			Deadline int64
+		}{exam, exam.Deadline().UnixNano() / int64(time.Millisecond)}); e != nil {
+			internalError(w, e)
+		}
+		return
+	}
+
+	if e := executeTemplate(w, "ExamReport", struct {
+		Exam *carddb.Exam
+	}{exam}); e != nil {
+		internalError(w, e)
+		return
+	}
+}
+
+// examReport is the exported form of a finished exam
+type examReport struct {
+	ID        int
+	Decks     string
+	Started   time.Time
+	Finished  time.Time
+	TimeLimit string
+	Late      bool
+	Score     int
+	Total     int
+	Cards     []carddb.ExamCard
+}
+
+func examExportHandler(w http.ResponseWriter, r *http.Request) {
+	// Download the report of a finished exam as CSV, or JSON with format=json
+	exam, e := getExam(r)
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+	if exam == nil || !exam.Done() {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := fmt.Sprintf("exam-%d", exam.ID)
+	if r.FormValue("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, name))
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if e := enc.Encode(examReport{
+			ID:        exam.ID,
+			Decks:     exam.Decks,
+			Started:   exam.Started,
+			Finished:  exam.Finished,
+			TimeLimit: exam.TimeLimit.String(),
+			Late:      exam.Late(),
+			Score:     exam.Score(),
+			Total:     len(exam.Cards),
+			Cards:     exam.Cards,
+		}); e != nil {
+			internalError(w, e)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, name))
+	out := csv.NewWriter(w)
+	out.Write([]string{"card", "front", "back", "answer", "correct"})
+	for _, c := range exam.Cards {
+		out.Write([]string{strconv.Itoa(c.CardID), c.Front, c.Back, c.Answer, strconv.FormatBool(c.Correct)})
+	}
+	out.Write([]string{"score", strconv.Itoa(exam.Score()), strconv.Itoa(len(exam.Cards)), "", ""})
+	out.Flush()
+	if e := out.Error(); e != nil {
+		internalError(w, e)
+	}
+}
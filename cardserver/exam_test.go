@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExam(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	deck, e := db.NewDeck("Deck")
+	if e != nil {
+		t.Fatal(e)
+	}
+	card, e := db.NewCard()
+	if e != nil {
+		t.Fatal(e)
+	}
+	card.Front = "capital of France"
+	card.Back = "Paris"
+	if e := db.UpdateCard(card); e != nil {
+		t.Fatal(e)
+	}
+	if e := db.AddCardToDeck(card.ID, deck.ID); e != nil {
+		t.Fatal(e)
+	}
+
+	post := func(u string, form url.Values) (*http.Response, string) {
+		t.Helper()
+		res, e := http.PostForm(u, form)
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer res.Body.Close()
+		body, e := io.ReadAll(res.Body)
+		if e != nil {
+			t.Fatal(e)
+		}
+		return res, string(body)
+	}
+
+	res, body := post(base+"/exam/new", url.Values{
+		"decks":   {strconv.Itoa(deck.ID)},
+		"cards":   {"5"},
+		"minutes": {"1"},
+	})
+	if !strings.Contains(body, "capital of France") || strings.Contains(body, "Paris") {
+		t.Fatalf("exam page should ask without showing answers:\n%s", body)
+	}
+	examURL := res.Request.URL.String()
+
+	_, body = post(examURL, url.Values{fmt.Sprintf("a%d", card.ID): {"paris"}})
+	if !strings.Contains(body, "Score: 1/1") {
+		t.Errorf("report:\n%s", body)
+	}
+	if got := db.GetCard(card.ID); got.Views != 0 || !got.LastView.Equal(card.LastView) {
+		t.Errorf("exam changed the card: %+v", got)
+	}
+
+	exportURL := strings.Replace(examURL, "/exam/", "/exam/export/", 1)
+	if csv := get(t, exportURL); !strings.Contains(csv, "capital of France,Paris,paris,true") {
+		t.Errorf("csv export:\n%s", csv)
+	}
+	report := examReport{}
+	if e := json.Unmarshal([]byte(get(t, exportURL+"&format=json")), &report); e != nil {
+		t.Fatal(e)
+	}
+	if report.Score != 1 || report.Total != 1 || len(report.Cards) != 1 || report.Late {
+		t.Errorf("json export: %+v", report)
+	}
+
+	for _, minutes := range []string{"0.001", "NaN", "Inf", "1e300"} {
+		res, _ := post(base+"/exam/new", url.Values{
+			"decks":   {strconv.Itoa(deck.ID)},
+			"cards":   {"5"},
+			"minutes": {minutes},
+		})
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %s for %s minutes", res.Status, minutes)
+		}
+	}
+}
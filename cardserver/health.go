@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// readyTimeout bounds how long the readiness checks may take
+const readyTimeout = 5 * time.Second
+
+// check is the result of a single readiness check
+type check struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func checkResult(e error) check {
+	if e != nil {
+		return check{Status: "fail", Error: e.Error()}
+	}
+	return check{Status: "ok"}
+}
+
+// healthzHandler reports that the process is alive
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		Status string `json:"status"`
+	}{"ok"})
+}
+
+// readyzHandler reports whether the server can handle requests: the database responds,
+// has the expected schema version and its file can be written to. It responds 503 if any
+// check fails.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	checks := map[string]check{
+		"db": checkResult(db.PingContext(ctx)),
+	}
+
+	version, e := db.SchemaVersion()
+	if e == nil && version != carddb.SchemaVersion {
+		e = fmt.Errorf("schema version %d, want %d", version, carddb.SchemaVersion)
+	}
+	checks["schema"] = checkResult(e)
+	checks["disk"] = checkResult(db.CheckWritable())
+
+	status, code := "ok", http.StatusOK
+	for _, c := range checks {
+		if c.Status != "ok" {
+			status, code = "fail", http.StatusServiceUnavailable
+		}
+	}
+
+	writeJSON(w, code, struct {
+		Status string           `json:"status"`
+		Checks map[string]check `json:"checks"`
+	}{status, checks})
+}
+
+// writeJSON responds with v encoded as JSON
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if e := json.NewEncoder(w).Encode(v); e != nil {
+		log.Println(e)
+	}
+}
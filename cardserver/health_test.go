@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+)
+
+type readyResponse struct {
+	Status string           `json:"status"`
+	Checks map[string]check `json:"checks"`
+}
+
+func getReady(t *testing.T, url string, status int) readyResponse {
+	t.Helper()
+	var got readyResponse
+	if e := json.Unmarshal([]byte(getStatus(t, url+"/readyz", status)), &got); e != nil {
+		t.Fatal(e)
+	}
+	return got
+}
+
+func TestHealthz(t *testing.T) {
+	url, _, _ := startServer(t, defaultConfig(), nil)
+
+	if body := get(t, url+"/healthz"); body != "{\"status\":\"ok\"}\n" {
+		t.Errorf("got: %q", body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	url, _, _ := startServer(t, defaultConfig(), nil)
+
+	got := getReady(t, url, http.StatusOK)
+	if got.Status != "ok" || len(got.Checks) != 3 {
+		t.Errorf("got: %+v", got)
+	}
+
+	if _, e := db.Exec(`PRAGMA user_version = 1000`); e != nil {
+		t.Fatal(e)
+	}
+	got = getReady(t, url, http.StatusServiceUnavailable)
+	if got.Checks["schema"].Status != "fail" || got.Checks["db"].Status != "ok" {
+		t.Errorf("got: %+v", got)
+	}
+
+	if e := os.Remove(cfg.DB.File); e != nil {
+		t.Fatal(e)
+	}
+	got = getReady(t, url, http.StatusServiceUnavailable)
+	if got.Checks["disk"].Status != "fail" {
+		t.Errorf("got: %+v", got)
+	}
+}
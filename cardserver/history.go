@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// undoBanner is the data for the Undo template, offering to revert Rev then go to Next
+type undoBanner struct {
+	Rev *carddb.Revision
+	// Next is the URL to go to after undoing, or empty for the item's history
+	Next string
+}
+
+// author returns who made request r for revisions. There are no user accounts, so it's the
+// client's address.
+func author(r *http.Request) string {
+	host, _, e := net.SplitHostPort(r.RemoteAddr)
+	if e != nil || host == "" {
+		return "web"
+	}
+	return host
+}
+
+// undoParam returns the revision named by the "undo" parameter of r, or nil if there isn't
+// one
+func undoParam(r *http.Request) *carddb.Revision {
+	id, e := strconv.Atoi(r.FormValue("undo"))
+	if e != nil {
+		return nil
+	}
+	rev, e := db.GetRevision(id)
+	if e != nil {
+		log.Println(e)
+	}
+	return rev
+}
+
+// withUndo adds the "undo" parameter for rev to u so the page shows the undo banner
+func withUndo(u string, rev *carddb.Revision) string {
+	if rev == nil {
+		return u
+	}
+	sep := "?"
+	if strings.Contains(u, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%sundo=%d", u, sep, rev.ID)
+}
+
+// localURL returns true if u is a path to a page of this app. Browsers drop control
+// characters and read backslashes as slashes, so "/\t/host" and "/\\host" would go to other
+// sites; those are refused along with anything that has a scheme, host or fragment.
+func localURL(u string) bool {
+	if strings.IndexFunc(u, func(r rune) bool { return r < ' ' || r == 0x7f || r == '\\' }) >= 0 {
+		return false
+	}
+	parsed, e := url.Parse(u)
+	if e != nil || parsed.Scheme != "" || parsed.Host != "" || parsed.Opaque != "" || parsed.User != nil ||
+		parsed.Fragment != "" {
+		return false
+	}
+	// Clean drops the trailing slash most pages have
+	clean := path.Clean(parsed.Path)
+	if strings.HasSuffix(parsed.Path, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean == parsed.Path && strings.HasPrefix(parsed.Path, urlFor("/"))
+}
+
+// historyURL returns the URL of the history page of the revision's item
+func historyURL(rev *carddb.Revision) string {
+	if rev.Kind == carddb.KindDeck {
+		return urlFor(fmt.Sprintf("/history/?d=%d", rev.ItemID))
+	}
+	return urlFor(fmt.Sprintf("/history/?c=%d", rev.ItemID))
+}
+
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	// Show the revisions of the given card or deck, newest first
+	form, e := parseForm(r)
+	if e != nil || (form.Card == nil && form.Deck == nil) {
+		if e != nil {
+			log.Println(e)
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	var revs []*carddb.Revision
+	var next string
+	if form.Card != nil {
+		revs, e = db.GetRevisions(carddb.KindCard, form.Card.ID)
+		next = urlFor(fmt.Sprintf("/history/?c=%d", form.Card.ID))
+	} else {
+		revs, e = db.GetRevisions(carddb.KindDeck, form.Deck.ID)
+		next = urlFor(fmt.Sprintf("/history/?d=%d", form.Deck.ID))
+	}
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+
+	if e := executeTemplate(w, "History", struct {
+		Card      *carddb.Card
+		Deck      *carddb.Deck
+		Revisions []*carddb.Revision
+		Next      string
+		Undo      undoBanner
+	}{form.Card, form.Deck, revs, next, undoBanner{undoParam(r), next}}); e != nil {
+		internalError(w, e)
+		return
+	}
+}
+
+func undoHandler(w http.ResponseWriter, r *http.Request) {
+	// Revert the posted revision "r", then go to "next" with a banner to redo
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, urlFor("/"), http.StatusFound)
+		return
+	}
+	id, e := strconv.Atoi(r.FormValue("r"))
+	if e != nil {
+		http.Error(w, fmt.Sprintf("Bad revision ID %q", r.FormValue("r")), http.StatusBadRequest)
+		return
+	}
+	revert, e := db.Revert(id, author(r))
+	if e != nil {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+
+	next := r.FormValue("next")
+	if !localURL(next) {
+		next = historyURL(revert)
+	}
+	http.Redirect(w, r, withUndo(next, revert), http.StatusFound)
+}
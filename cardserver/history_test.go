@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// postForm posts values to u and returns the body of the page it ends up on
+func postForm(t *testing.T, u string, values url.Values) string {
+	t.Helper()
+	res, e := http.PostForm(u, values)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer res.Body.Close()
+	body, e := io.ReadAll(res.Body)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("POST %s: %s\n%s", u, res.Status, body)
+	}
+	return string(body)
+}
+
+// undoID returns the revision offered by the undo banner in body
+func undoID(t *testing.T, body string) string {
+	t.Helper()
+	m := regexp.MustCompile(`<div class="undo">\s*<form[^>]*>[^<]*<input type="hidden" name="r" value="(\d+)">`).FindStringSubmatch(body)
+	if m == nil {
+		t.Fatalf("no undo banner:\n%s", body)
+	}
+	return m[1]
+}
+
+func TestEditUndo(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	card, _ := db.NewCard()
+	card.Front = "hola"
+	card.Back = "hello"
+	db.UpdateCard(card)
+
+	editURL := fmt.Sprintf("%s/card/edit/?c=%d", base, card.ID)
+	body := postForm(t, editURL, url.Values{"front": {"adios"}, "back": {"hello"}, "views": {"0"}})
+	rev := undoID(t, body)
+
+	history := get(t, fmt.Sprintf("%s/history/?c=%d", base, card.ID))
+	for _, want := range []string{"Edited card", "Front:", `class="diff-extra">hola`, `class="diff-missing">adios`} {
+		if !strings.Contains(history, want) {
+			t.Errorf("history missing %q:\n%s", want, history)
+		}
+	}
+
+	// Undoing goes to the history page with a redo banner
+	body = postForm(t, base+"/undo/", url.Values{"r": {rev}})
+	if got := db.GetCard(card.ID); got.Front != "hola" {
+		t.Errorf("got after undo: %+v", got)
+	}
+	if !strings.Contains(body, "Redo") {
+		t.Errorf("no redo banner:\n%s", body)
+	}
+	postForm(t, base+"/undo/", url.Values{"r": {undoID(t, body)}})
+	if got := db.GetCard(card.ID); got.Front != "adios" {
+		t.Errorf("got after redo: %+v", got)
+	}
+
+	// Undo a delete
+	body = postForm(t, fmt.Sprintf("%s/card/delete/?c=%d", base, card.ID), nil)
+	postForm(t, base+"/undo/", url.Values{"r": {undoID(t, body)}})
+	if db.GetCard(card.ID) == nil {
+		t.Error("deleted card not restored")
+	}
+}
+
+func TestStudyUndo(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	deck, _ := db.NewDeck("Deck")
+	card, _ := db.NewCard()
+	db.AddCardToDeck(card.ID, deck.ID)
+
+	// Show the card, mark it again, then undo the grade
+	body := get(t, fmt.Sprintf("%s/deck/study/?d=%d", base, deck.ID))
+	m := regexp.MustCompile(`dv=-1&r=(\d+)`).FindStringSubmatch(body)
+	if m == nil {
+		t.Fatalf("no -1 link with the grade:\n%s", body)
+	}
+	body = get(t, fmt.Sprintf("%s/deck/study/?d=%d&c=%d&dv=-1&r=%s", base, deck.ID, card.ID, m[1]))
+	if reviews, _ := db.GetReviews(card.ID); len(reviews) != 1 || reviews[0].Grade != carddb.GradeAgain {
+		t.Errorf("got reviews: %+v", reviews)
+	}
+	if rev := undoID(t, body); rev != m[1] {
+		t.Errorf("got undo %s want: %s", rev, m[1])
+	}
+
+	postForm(t, base+"/undo/", url.Values{"r": {m[1]}, "next": {fmt.Sprintf("/deck/?d=%d", deck.ID)}})
+	if got := db.GetCard(card.ID); got.Views != 0 || got.LastView.Year() > 1 {
+		t.Errorf("got after undo: %+v", got)
+	}
+	if reviews, _ := db.GetReviews(card.ID); len(reviews) != 0 {
+		t.Errorf("got reviews after undo: %+v", reviews)
+	}
+
+	// Only app pages are followed after undoing
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	for _, next := range []string{
+		"//example.com/", `/\example.com/`, "https://example.com/", "/\t/example.com/", "/\n/example.com/",
+		"/deck/../../example.com/", "http:/example.com/",
+	} {
+		res, e := client.PostForm(base+"/undo/", url.Values{"r": {m[1]}, "next": {next}})
+		if e != nil {
+			t.Fatal(e)
+		}
+		res.Body.Close()
+		if loc := res.Header.Get("Location"); !strings.HasPrefix(loc, "/history/") {
+			t.Errorf("next %q redirected to %q", next, loc)
+		}
+	}
+	next := fmt.Sprintf("/deck/?d=%d", deck.ID)
+	res, e := client.PostForm(base+"/undo/", url.Values{"r": {m[1]}, "next": {next}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	res.Body.Close()
+	if loc := res.Header.Get("Location"); !strings.HasPrefix(loc, next+"&undo=") {
+		t.Errorf("next %q redirected to %q", next, loc)
+	}
+}
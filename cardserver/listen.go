@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unixPrefix marks an address as a Unix domain socket path, e.g. "unix:/run/cards.sock"
+const unixPrefix = "unix:"
+
+// certCheckInterval is how often the certificate files are checked for changes
+var certCheckInterval = 10 * time.Second
+
+// listen listens on addr, which is either a TCP address such as ":8081" or
+// "127.0.0.1:8081", or a Unix socket path prefixed with "unix:". A stale socket file
+// left by a previous run is removed first.
+func listen(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, unixPrefix) {
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, unixPrefix)
+	if fi, e := os.Stat(path); e == nil && fi.Mode()&fs.ModeSocket != 0 {
+		if c, e := net.Dial("unix", path); e == nil {
+			c.Close()
+			return nil, errors.New("socket " + path + " is in use")
+		}
+		if e := os.Remove(path); e != nil {
+			return nil, e
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// certReloader serves a TLS certificate from a cert/key pair, loading it again when
+// either file changes so certificates can be renewed without restarting the server.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// newCertReloader loads the given pair, failing if it is not valid
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	modTime, e := r.latestModTime()
+	if e != nil {
+		return nil, e
+	}
+	if e := r.load(modTime); e != nil {
+		return nil, e
+	}
+	return r, nil
+}
+
+// latestModTime returns the most recent modification time of the cert and key files
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		fi, e := os.Stat(f)
+		if e != nil {
+			return latest, e
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) load(modTime time.Time) error {
+	cert, e := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if e != nil {
+		return e
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// GetCertificate is for tls.Config. If the files have changed since they were last
+// loaded they are loaded again. A pair that fails to load, such as when only one of
+// the files has been replaced so far, is logged and the previous certificate is kept.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) < certCheckInterval {
+		return r.cert, nil
+	}
+	r.checked = time.Now()
+
+	modTime, e := r.latestModTime()
+	if e != nil {
+		log.Println("Checking TLS certificate:", e)
+		return r.cert, nil
+	}
+	if modTime.After(r.modTime) {
+		if e := r.load(modTime); e != nil {
+			log.Println("Reloading TLS certificate:", e)
+		} else {
+			log.Println("Reloaded TLS certificate", r.certFile)
+		}
+	}
+	return r.cert, nil
+}
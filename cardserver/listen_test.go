@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cards.sock")
+
+	// Leave a stale socket file behind like a crashed server would
+	stale, e := net.Listen("unix", path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, e := listen(unixPrefix + path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			c, e := ln.Accept()
+			if e != nil {
+				return
+			}
+			c.Write([]byte("ok"))
+			c.Close()
+		}
+	}()
+	c, e := net.Dial("unix", path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer c.Close()
+	buf := make([]byte, 2)
+	if _, e := c.Read(buf); e != nil || string(buf) != "ok" {
+		t.Errorf("got: %q, %v want: %q", buf, e, "ok")
+	}
+
+	if _, e := listen(unixPrefix + path); e == nil {
+		t.Error("listening on a socket that is in use succeeded")
+	}
+}
+
+// writeCert writes a new self-signed certificate for name and returns its DER bytes
+func writeCert(t *testing.T, certFile, keyFile, name string) []byte {
+	t.Helper()
+	key, e := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if e != nil {
+		t.Fatal(e)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, e := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if e != nil {
+		t.Fatal(e)
+	}
+	keyDER, e := x509.MarshalECPrivateKey(key)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); e != nil {
+		t.Fatal(e)
+	}
+	if e := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); e != nil {
+		t.Fatal(e)
+	}
+	return der
+}
+
+// touch sets the modification time of the files to d in the future so the change is
+// seen regardless of file system time resolution
+func touch(t *testing.T, d time.Duration, files ...string) {
+	t.Helper()
+	future := time.Now().Add(d)
+	for _, f := range files {
+		if e := os.Chtimes(f, future, future); e != nil {
+			t.Fatal(e)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	defer func(d time.Duration) { certCheckInterval = d }(certCheckInterval)
+	certCheckInterval = 0
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	first := writeCert(t, certFile, keyFile, "first")
+	r, e := newCertReloader(certFile, keyFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	check := func(want []byte) {
+		t.Helper()
+		got, e := r.GetCertificate(&tls.ClientHelloInfo{})
+		if e != nil {
+			t.Fatal(e)
+		}
+		if !bytes.Equal(got.Certificate[0], want) {
+			t.Error("got the wrong certificate")
+		}
+	}
+	check(first)
+
+	second := writeCert(t, certFile, keyFile, "second")
+	touch(t, time.Minute, certFile, keyFile)
+	check(second)
+
+	// A broken pair keeps the last good certificate
+	if e := os.WriteFile(keyFile, []byte("not a key"), 0600); e != nil {
+		t.Fatal(e)
+	}
+	touch(t, 2*time.Minute, keyFile)
+	check(second)
+
+	if _, e := newCertReloader(certFile, keyFile); e == nil {
+		t.Error("loading a broken pair succeeded")
+	}
+}
@@ -1,74 +1,126 @@
 package main
 
 import (
-	"flag"
+	"context"
+	"embed"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Bredgren/cards/carddb"
 )
 
-var (
-	port   = 8081
-	static = "."
-	dbFile = "cards.db"
-)
+var cfg = defaultConfig()
 
 var handlers = map[string]http.HandlerFunc{
-	"/deck/new":     deckNewHandler,
-	"/deck/edit/":   deckEditHandler,
-	"/deck/delete/": deckDeleteHandler,
-	"/deck/study/":  deckStudyHandler,
-	"/deck/":        deckHandler,
-	"/card/new/":    cardNewHandler,
-	"/card/edit/":   cardEditHandler,
-	"/card/delete/": cardDeleteHandler,
-	"/card/":        cardHandler,
-	"/":             rootHandler,
+	"/deck/new":         deckNewHandler,
+	"/deck/edit/":       deckEditHandler,
+	"/deck/delete/":     deckDeleteHandler,
+	"/deck/study/":      deckStudyHandler,
+	"/deck/quiz/":       deckQuizHandler,
+	"/deck/clone/":      deckCloneHandler,
+	"/deck/":            deckHandler,
+	"/card/new/":        cardNewHandler,
+	"/card/edit/":       cardEditHandler,
+	"/card/delete/":     cardDeleteHandler,
+	"/card/bulk/":       cardBulkHandler,
+	"/card/decks/":      cardDecksHandler,
+	"/card/duplicates/": cardDuplicatesHandler,
+	"/card/":            cardHandler,
+	"/quiz/":            quizHandler,
+	"/exam/new":         examNewHandler,
+	"/exam/export/":     examExportHandler,
+	"/exam/":            examHandler,
+	"/stats/":           statsHandler,
+	"/history/":         historyHandler,
+	"/undo/":            undoHandler,
+	"/trash/":           trashHandler,
+	"/orphans/":         orphansHandler,
+	"/preset/edit/":     presetEditHandler,
+	"/preset/":          presetHandler,
+	"/":                 rootHandler,
 }
 
 var (
 	db *carddb.Database
 )
 
-var tmpl = template.Must(template.New("tmpl").ParseFiles(
-	"./tmpl/root.tmpl",
-	"./tmpl/newDeck.tmpl",
-	"./tmpl/editDeck.tmpl",
-	"./tmpl/delDeck.tmpl",
-	"./tmpl/studyDeck.tmpl",
-	"./tmpl/showDeck.tmpl",
-	"./tmpl/newCard.tmpl",
-	"./tmpl/editCard.tmpl",
-	"./tmpl/delCard.tmpl",
-	"./tmpl/showCard.tmpl",
-))
+// assets holds the templates and static files so the binary can run from any directory
+//
+//go:embed tmpl static
+var assets embed.FS
 
-func main() {
-	flag.IntVar(&port, "port", port, "HTTP port")
-	flag.StringVar(&static, "s", static, "Static file directory")
-	flag.StringVar(&dbFile, "db", dbFile, "SQL card database file")
-	flag.Parse()
+const tmplPattern = "tmpl/*.tmpl"
+
+// tmplFuncs are the functions available to templates
+var tmplFuncs = template.FuncMap{
+	"url": urlFor,
+}
+
+var tmpl = template.Must(template.New("tmpl").Funcs(tmplFuncs).ParseFS(assets, tmplPattern))
+
+// urlFor returns the URL for the given app path, taking the configured base path into
+// account. Templates call it as {{url "/deck/"}}.
+func urlFor(path string) string {
+	return strings.TrimSuffix(cfg.BasePath, "/") + path
+}
 
-	for path, handler := range handlers {
-		http.HandleFunc(path, handler)
+// executeTemplate renders the named template to w. In dev mode the templates are parsed
+// from disk on every call so changes show up without restarting the server.
+func executeTemplate(w io.Writer, name string, data interface{}) error {
+	t := tmpl
+	if cfg.Dev {
+		var e error
+		t, e = template.New("tmpl").Funcs(tmplFuncs).ParseGlob(filepath.Join(cfg.Static, tmplPattern))
+		if e != nil {
+			return e
+		}
 	}
+	return t.ExecuteTemplate(w, name, data)
+}
 
-	http.Handle("/static/", http.FileServer(http.Dir(static)))
+func main() {
+	cfg = loadConfigOrExit()
 
 	var e error
-	db, e = carddb.OpenDatabase(dbFile)
+	db, e = carddb.OpenDatabase(cfg.DB.File)
 	if e != nil {
 		log.Fatal(e)
 	}
+	db.SetMaxOpenConns(cfg.DB.MaxOpenConns)
+	db.ObserveQuery = observeQuery
 
-	addr := fmt.Sprintf(":%d", port)
-	log.Println("Server started at", addr)
-	log.Fatal(http.ListenAndServe(addr, nil))
+	srv, e := newServer()
+	if e != nil {
+		log.Fatal(e)
+	}
+
+	ln, e := listen(cfg.Addr)
+	if e != nil {
+		log.Fatal(e)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go purgeTrash(ctx, trashPurgeInterval)
+	go snapshotDB(ctx, cfg.Backup.Interval)
+
+	log.Println("Server started at", ln.Addr())
+	if e := serve(ctx, srv, ln); e != nil {
+		log.Fatal(e)
+	}
+	log.Println("Server stopped")
 }
 
 func rootHandler(w http.ResponseWriter, r *http.Request) {
@@ -76,6 +128,8 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 	rootInfo := struct {
 		Decks    []*carddb.Deck
 		NumCards []int
+		Streak   carddb.Streak
+		Heatmap  template.HTML
 	}{}
 
 	var e error
@@ -96,7 +150,20 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 		rootInfo.NumCards[i] = len(cards)
 	}
 
-	if e := tmpl.ExecuteTemplate(w, "Root", rootInfo); e != nil {
+	loc := cfg.location()
+	if rootInfo.Streak, e = db.GetStreak(loc); e != nil {
+		internalError(w, e)
+		return
+	}
+	now := time.Now().In(loc)
+	year, e := db.DailyReviews(-1, now.AddDate(-1, 0, 1), now, loc)
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+	rootInfo.Heatmap = heatmap(year)
+
+	if e := executeTemplate(w, "Root", rootInfo); e != nil {
 		internalError(w, e)
 		return
 	}
@@ -125,11 +192,18 @@ func deckNewHandler(w http.ResponseWriter, r *http.Request) {
 			internalError(w, e)
 			return
 		}
+		typeAnswer := r.PostForm.Get("typeAnswer") != ""
+		leechThreshold, e := strconv.Atoi(r.PostForm.Get("leechThreshold"))
+		if e != nil {
+			internalError(w, e)
+			return
+		}
+		leechSuspend := r.PostForm.Get("leechSuspend") != ""
 
 		deck, e := db.NewDeck(name)
 		if e != nil {
 			log.Println(e)
-			if e = tmpl.ExecuteTemplate(w, "NewDeckFail", struct {
+			if e = executeTemplate(w, "NewDeckFail", struct {
 				Name  string
 				Error string
 			}{name, e.Error()}); e != nil {
@@ -142,12 +216,15 @@ func deckNewHandler(w http.ResponseWriter, r *http.Request) {
 		deck.DateWeight = dateWeight
 		deck.ViewWeight = viewWeight
 		deck.ViewLimit = viewLimit
+		deck.TypeAnswer = typeAnswer
+		deck.LeechThreshold = leechThreshold
+		deck.LeechSuspend = leechSuspend
 		if e := db.UpdateDeck(deck); e != nil {
 			internalError(w, e)
 			return
 		}
 
-		if e := tmpl.ExecuteTemplate(w, "NewDeckSuccess", struct {
+		if e := executeTemplate(w, "NewDeckSuccess", struct {
 			Deck *carddb.Deck
 		}{deck}); e != nil {
 			internalError(w, e)
@@ -157,7 +234,10 @@ func deckNewHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if e := tmpl.ExecuteTemplate(w, "NewDeck", nil); e != nil {
+	if e := executeTemplate(w, "NewDeck", struct {
+		Defaults       deckDefaults
+		LeechThreshold int
+	}{cfg.Deck, carddb.DefaultLeechThreshold}); e != nil {
 		internalError(w, e)
 		return
 	}
@@ -189,16 +269,35 @@ func deckEditHandler(w http.ResponseWriter, r *http.Request) {
 			internalError(w, e)
 			return
 		}
+		leechThreshold, e := strconv.Atoi(r.PostForm.Get("leechThreshold"))
+		if e != nil {
+			internalError(w, e)
+			return
+		}
 
 		form.Deck.Name = name
 		form.Deck.DateWeight = dateWeight
 		form.Deck.ViewWeight = viewWeight
 		form.Deck.ViewLimit = viewLimit
-		db.UpdateDeck(form.Deck)
+		form.Deck.TypeAnswer = r.PostForm.Get("typeAnswer") != ""
+		form.Deck.LeechThreshold = leechThreshold
+		form.Deck.LeechSuspend = r.PostForm.Get("leechSuspend") != ""
 
-		if e := tmpl.ExecuteTemplate(w, "EditDeckSuccess", struct {
+		presetID, _ := strconv.Atoi(r.PostForm.Get("preset"))
+		if e := db.CheckDeckPreset(presetID, r.PostForm["override"]); e != nil {
+			http.Error(w, e.Error(), http.StatusBadRequest)
+			return
+		}
+		rev, e := db.EditDeckPreset(form.Deck, presetID, r.PostForm["override"], author(r))
+		if e != nil {
+			internalError(w, e)
+			return
+		}
+
+		if e := executeTemplate(w, "EditDeckSuccess", struct {
 			Deck *carddb.Deck
-		}{form.Deck}); e != nil {
+			Undo undoBanner
+		}{db.GetDeck(form.Deck.ID), undoBanner{Rev: rev}}); e != nil {
 			internalError(w, e)
 			return
 		}
@@ -206,9 +305,16 @@ func deckEditHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if e := tmpl.ExecuteTemplate(w, "EditDeck", struct {
-		Deck *carddb.Deck
-	}{form.Deck}); e != nil {
+	presets, e := getDeckPresetForm(form.Deck.ID)
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+
+	if e := executeTemplate(w, "EditDeck", struct {
+		Deck   *carddb.Deck
+		Preset *deckPresetForm
+	}{form.Deck, presets}); e != nil {
 		internalError(w, e)
 		return
 	}
@@ -224,15 +330,16 @@ func deckDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == http.MethodPost {
-		e := db.DelDeck(form.Deck.ID)
+		rev, e := db.TrashDeck(form.Deck.ID, author(r))
 		if e != nil {
 			internalError(w, e)
 			return
 		}
 
-		if e := tmpl.ExecuteTemplate(w, "DelDeckSuccess", struct {
+		if e := executeTemplate(w, "DelDeckSuccess", struct {
 			Deck *carddb.Deck
-		}{form.Deck}); e != nil {
+			Undo undoBanner
+		}{form.Deck, undoBanner{rev, urlFor(fmt.Sprintf("/deck/?d=%d", form.Deck.ID))}}); e != nil {
 			internalError(w, e)
 			return
 		}
@@ -240,7 +347,7 @@ func deckDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if e := tmpl.ExecuteTemplate(w, "DelDeck", struct {
+	if e := executeTemplate(w, "DelDeck", struct {
 		Deck *carddb.Deck
 	}{form.Deck}); e != nil {
 		internalError(w, e)
@@ -258,34 +365,190 @@ func deckStudyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The previous card's grade, passed along so it can be undone
+	undo := undoParam(r)
 	if form.Card == nil {
-		cards, e := db.GetCards(form.Deck.ID)
+		randCard, before, e := db.StudyCard(form.Deck)
 		if e != nil {
 			internalError(w, e)
 			return
 		}
-		randCard := carddb.RandomCard(form.Deck, cards)
-		db.ViewCard(randCard)
-		http.Redirect(w, r, fmt.Sprintf("/deck/study/?d=%d&c=%d", form.Deck.ID, randCard.ID), http.StatusFound)
+		if randCard == nil {
+			http.Redirect(w, r, withUndo(urlFor(fmt.Sprintf("/deck/?d=%d", form.Deck.ID)), undo), http.StatusFound)
+			return
+		}
+		studyURL := urlFor(fmt.Sprintf("/deck/study/?d=%d&c=%d", form.Deck.ID, randCard.ID))
+		if !form.Deck.TypeAnswer {
+			// Graded good unless the -1 link is followed. Typed answers are graded when
+			// they're checked.
+			rev, e := db.GradeCard(before, randCard, &carddb.Review{
+				CardID: randCard.ID,
+				DeckID: form.Deck.ID,
+				Grade:  carddb.GradeGood,
+			}, author(r))
+			if e != nil {
+				internalError(w, e)
+				return
+			}
+			studyURL += fmt.Sprintf("&r=%d", rev.ID)
+			recordGrade(form.Deck.ID, carddb.GradeGood)
+		}
+		recordReview(form.Deck.ID)
+		http.Redirect(w, r, withUndo(studyURL, undo), http.StatusFound)
 		return
 	}
 
+	// The grade of the card being shown
+	graded, _ := strconv.Atoi(r.FormValue("r"))
+
 	if form.DV != 0 {
 		form.Card.Views += form.DV
 		db.UpdateCard(form.Card)
-		http.Redirect(w, r, fmt.Sprintf("/deck/study/?d=%d&c=%d", form.Deck.ID, form.Card.ID), http.StatusFound)
+		if form.DV < 0 {
+			regraded, e := regradeAgain(form.Deck, form.Card)
+			if e != nil {
+				internalError(w, e)
+				return
+			}
+			if regraded {
+				recordGrade(form.Deck.ID, carddb.GradeAgain)
+			}
+		}
+		studyURL := urlFor(fmt.Sprintf("/deck/study/?d=%d&c=%d", form.Deck.ID, form.Card.ID))
+		if graded != 0 {
+			studyURL += fmt.Sprintf("&r=%d&undo=%d", graded, graded)
+		}
+		http.Redirect(w, r, studyURL, http.StatusFound)
 		return
 	}
 
-	if e := tmpl.ExecuteTemplate(w, "Study", struct {
-		Deck *carddb.Deck
-		Card *carddb.Card
-	}{form.Deck, form.Card}); e != nil {
+	if r.Method == http.MethodPost && form.Deck.TypeAnswer {
+		// The result is shown by redirecting to the graded card, so reloading it doesn't
+		// grade it again
+		answer := r.PostForm.Get("answer")
+		res := carddb.CheckAnswer(answer, form.Card.Back)
+		before := *form.Card
+		grade := carddb.GradeCorrect
+		if !res.Correct {
+			grade = carddb.GradeIncorrect
+			// The same as the -1 link when answers aren't typed
+			form.Card.Views--
+		}
+		rev, e := db.GradeCard(&before, form.Card, &carddb.Review{
+			CardID:   form.Card.ID,
+			DeckID:   form.Deck.ID,
+			Grade:    grade,
+			Answer:   answer,
+			Duration: answerTime(r.PostForm.Get("shown")),
+		}, author(r))
+		if e != nil {
+			internalError(w, e)
+			return
+		}
+		if !res.Correct {
+			if _, e := db.CheckLeech(form.Deck, form.Card); e != nil {
+				internalError(w, e)
+				return
+			}
+		}
+		recordGrade(form.Deck.ID, grade)
+		studyURL := urlFor(fmt.Sprintf("/deck/study/?d=%d&c=%d&r=%d&undo=%d", form.Deck.ID, form.Card.ID, rev.ID, rev.ID))
+		http.Redirect(w, r, studyURL, http.StatusSeeOther)
+		return
+	}
+
+	var result *carddb.AnswerResult
+	answer := ""
+	if graded != 0 && form.Deck.TypeAnswer {
+		review, e := gradedReview(form.Card, graded)
+		if e != nil {
+			internalError(w, e)
+			return
+		}
+		// The grade may have been undone
+		if review != nil {
+			answer = review.Answer
+			res := carddb.CheckAnswer(answer, form.Card.Back)
+			result = &res
+		} else {
+			graded = 0
+		}
+	}
+
+	if e := executeTemplate(w, "Study", struct {
+		Deck   *carddb.Deck
+		Card   *carddb.Card
+		Result *carddb.AnswerResult
+		Answer string
+		// Shown is when the page was made in milliseconds since the epoch, for timing
+		// typed answers
+		Shown int64
+		// Graded is the revision of the card's grade, 0 until it's graded
+		Graded int
+		Undo   undoBanner
+	}{form.Deck, form.Card, result, answer, time.Now().UnixNano() / int64(time.Millisecond), graded,
+		undoBanner{undo, urlFor(fmt.Sprintf("/deck/study/?d=%d", form.Deck.ID))}}); e != nil {
 		internalError(w, e)
 		return
 	}
 }
 
+// maxAnswerTime is the longest time to answer that's recorded. Longer ones most likely
+// mean the page was left open.
+const maxAnswerTime = 10 * time.Minute
+
+// answerTime returns the time since shown, in milliseconds since the epoch, or 0 if shown
+// isn't valid
+func answerTime(shown string) time.Duration {
+	ms, e := strconv.ParseInt(shown, 10, 64)
+	if e != nil {
+		return 0
+	}
+	d := time.Since(time.Unix(0, ms*int64(time.Millisecond)))
+	if d <= 0 || d > maxAnswerTime {
+		return 0
+	}
+	return d
+}
+
+// gradedReview returns the review logged by the revision that graded card, or nil if
+// there isn't one
+func gradedReview(card *carddb.Card, revisionID int) (*carddb.Review, error) {
+	rev, e := db.GetRevision(revisionID)
+	if e != nil || rev == nil || rev.Kind != carddb.KindCard || rev.ItemID != card.ID || rev.ReviewID == 0 {
+		return nil, e
+	}
+	reviews, e := db.GetReviews(card.ID)
+	if e != nil {
+		return nil, e
+	}
+	for _, review := range reviews {
+		if review.ID == rev.ReviewID {
+			return review, nil
+		}
+	}
+	return nil, nil
+}
+
+// regradeAgain changes the review logged when card was shown from the deck to again, then
+// checks if that makes it a leech. It returns false if there was no such review.
+func regradeAgain(deck *carddb.Deck, card *carddb.Card) (bool, error) {
+	reviews, e := db.GetReviews(card.ID)
+	if e != nil || len(reviews) == 0 {
+		return false, e
+	}
+	last := reviews[0]
+	if last.DeckID != deck.ID || last.Grade != carddb.GradeGood {
+		return false, nil
+	}
+	last.Grade = carddb.GradeAgain
+	if e := db.UpdateReview(last); e != nil {
+		return false, e
+	}
+	_, e = db.CheckLeech(deck, card)
+	return true, e
+}
+
 func deckHandler(w http.ResponseWriter, r *http.Request) {
 	// Show settings and cards for a particular deck. If unspecified, redirect to root.
 	form, e := parseForm(r)
@@ -296,23 +559,17 @@ func deckHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if form.Deck == nil {
-		http.Redirect(w, r, "/", http.StatusFound)
+		http.Redirect(w, r, urlFor("/"), http.StatusFound)
 		return
 	}
 
-	deck := db.GetDeck(form.Deck.ID)
-	cards, e := db.GetCards(deck.ID)
+	list, e := getCardList(r, form.Deck)
 	if e != nil {
 		internalError(w, e)
 		return
 	}
-	sort.Sort(carddb.CardsByID(cards))
-	// LastViewed: card.LastView.Format("Mon Jan 2 15:04:05 2006"),
 
-	if e := tmpl.ExecuteTemplate(w, "ShowDeck", struct {
-		Deck  *carddb.Deck
-		Cards []*carddb.Card
-	}{deck, cards}); e != nil {
+	if e := executeTemplate(w, "ShowDeck", list); e != nil {
 		internalError(w, e)
 		return
 	}
@@ -350,7 +607,7 @@ func cardNewHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		if e := tmpl.ExecuteTemplate(w, "NewCardSuccess", struct {
+		if e := executeTemplate(w, "NewCardSuccess", struct {
 			Deck *carddb.Deck
 			Card *carddb.Card
 		}{form.Deck, card}); e != nil {
@@ -361,7 +618,7 @@ func cardNewHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if e := tmpl.ExecuteTemplate(w, "NewCard", struct {
+	if e := executeTemplate(w, "NewCard", struct {
 		Deck *carddb.Deck
 	}{form.Deck}); e != nil {
 		internalError(w, e)
@@ -394,14 +651,16 @@ func cardEditHandler(w http.ResponseWriter, r *http.Request) {
 		form.Card.Back = back
 		form.Card.Views = views
 
-		if e := db.UpdateCard(form.Card); e != nil {
+		rev, e := db.EditCard(form.Card, author(r))
+		if e != nil {
 			internalError(w, e)
 			return
 		}
 
-		if e := tmpl.ExecuteTemplate(w, "EditCardSuccess", struct {
+		if e := executeTemplate(w, "EditCardSuccess", struct {
 			Card *carddb.Card
-		}{form.Card}); e != nil {
+			Undo undoBanner
+		}{form.Card, undoBanner{Rev: rev}}); e != nil {
 			internalError(w, e)
 			return
 		}
@@ -409,9 +668,17 @@ func cardEditHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if e := tmpl.ExecuteTemplate(w, "EditCard", struct {
-		Card *carddb.Card
-	}{form.Card}); e != nil {
+	decks, others, e := cardDecks(form.Card.ID)
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+
+	if e := executeTemplate(w, "EditCard", struct {
+		Card   *carddb.Card
+		Decks  []*carddb.Deck
+		Others []*carddb.Deck
+	}{form.Card, decks, others}); e != nil {
 		internalError(w, e)
 		return
 	}
@@ -426,21 +693,23 @@ func cardDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == http.MethodPost {
-		if e := db.DelCard(form.Card.ID); e != nil {
+		rev, e := db.TrashCard(form.Card.ID, author(r))
+		if e != nil {
 			internalError(w, e)
 			return
 		}
 
-		if e := tmpl.ExecuteTemplate(w, "DelCardSuccess", struct {
+		if e := executeTemplate(w, "DelCardSuccess", struct {
 			Card *carddb.Card
-		}{form.Card}); e != nil {
+			Undo undoBanner
+		}{form.Card, undoBanner{rev, urlFor("/card/")}}); e != nil {
 			internalError(w, e)
 			return
 		}
 		return
 	}
 
-	if e := tmpl.ExecuteTemplate(w, "DelCard", struct {
+	if e := executeTemplate(w, "DelCard", struct {
 		Card *carddb.Card
 	}{form.Card}); e != nil {
 		internalError(w, e)
@@ -449,17 +718,13 @@ func cardDeleteHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func cardHandler(w http.ResponseWriter, r *http.Request) {
-	cards, e := db.GetCards(-1)
+	list, e := getCardList(r, nil)
 	if e != nil {
 		internalError(w, e)
 		return
 	}
-	sort.Sort(carddb.CardsByID(cards))
-	// LastViewed: card.LastView.Format("Mon Jan 2 15:04:05 2006"),
 
-	if e := tmpl.ExecuteTemplate(w, "ShowCard", struct {
-		Cards []*carddb.Card
-	}{cards}); e != nil {
+	if e := executeTemplate(w, "ShowCard", list); e != nil {
 		internalError(w, e)
 		return
 	}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics are exported at /metrics in the Prometheus text format
+var (
+	httpRequests = newCounterVec("cardserver_http_requests_total",
+		"HTTP requests by route, method and status code.", "route", "method", "code")
+	httpDuration = newHistogramVec("cardserver_http_request_duration_seconds",
+		"HTTP request latency by route.", "route")
+	dbQueryDuration = newHistogramVec("carddb_query_duration_seconds",
+		"Card database operation latency by operation.", "op")
+	studyReviews = newCounterVec("cardserver_study_reviews_total",
+		"Cards shown while studying, by deck ID.", "deck")
+	// A card failed with the -1 link after being graded good counts as both
+	studyGrades = newCounterVec("cardserver_study_grades_total",
+		"Grades given while studying, by deck ID and grade.", "deck", "grade")
+
+	allMetrics = []metric{httpRequests, httpDuration, dbQueryDuration, studyReviews, studyGrades}
+)
+
+// defBuckets are the histogram upper bounds in seconds
+var defBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+// labelKey joins label values into a map key
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// formatLabels returns the {name="value",...} part of a sample line
+func formatLabels(names, values []string, extra ...string) string {
+	var parts []string
+	for i, n := range names {
+		parts = append(parts, fmt.Sprintf("%s=%q", n, values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// counterVec is a set of counters with the same name distinguished by label values
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+	series map[string][]string
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]float64),
+		series: make(map[string][]string),
+	}
+}
+
+// inc adds one to the counter with the given label values
+func (c *counterVec) inc(values ...string) {
+	key := labelKey(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key]++
+	c.series[key] = values
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.series) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, c.series[key]), formatFloat(c.values[key]))
+	}
+}
+
+type histogram struct {
+	values []string
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// histogramVec is a set of histograms with the same name distinguished by label values
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+func newHistogramVec(name, help string, labels ...string) *histogramVec {
+	return &histogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: defBuckets,
+		series:  make(map[string]*histogram),
+	}
+}
+
+// observe records a duration in the histogram with the given label values
+func (h *histogramVec) observe(d time.Duration, values ...string) {
+	key := labelKey(values)
+	v := d.Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{values: values, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.values, "le", formatFloat(b)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.values), s.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// metricsHandler writes all metrics in the Prometheus text format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range allMetrics {
+		m.write(w)
+	}
+}
+
+// observeQuery is used as the carddb.Database.ObserveQuery hook
+func observeQuery(op string, d time.Duration) {
+	dbQueryDuration.observe(d, op)
+}
+
+// instrument wraps h to count requests and record their latency under route
+func instrument(route string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		httpRequests.inc(route, r.Method, strconv.Itoa(rec.status))
+		httpDuration.observe(time.Since(start), route)
+	})
+}
+
+// recordReview counts a card shown while studying deck
+func recordReview(deck int) {
+	studyReviews.inc(strconv.Itoa(deck))
+}
+
+// recordGrade counts a grade given while studying deck
+func recordGrade(deck int, grade string) {
+	studyGrades.inc(strconv.Itoa(deck), grade)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := newCounterVec("test_total", "Help text.", "a", "b")
+	c.inc("x", "1")
+	c.inc("x", "1")
+	c.inc("y", `"2"`)
+
+	var buf bytes.Buffer
+	c.write(&buf)
+	want := `# HELP test_total Help text.
+# TYPE test_total counter
+test_total{a="x",b="1"} 2
+test_total{a="y",b="\"2\""} 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := newHistogramVec("test_seconds", "Help text.", "op")
+	h.buckets = []float64{0.1, 1}
+	h.observe(50*time.Millisecond, "x")
+	h.observe(500*time.Millisecond, "x")
+	h.observe(2*time.Second, "x")
+
+	var buf bytes.Buffer
+	h.write(&buf)
+	want := `# HELP test_seconds Help text.
+# TYPE test_seconds histogram
+test_seconds_bucket{op="x",le="0.1"} 1
+test_seconds_bucket{op="x",le="1"} 2
+test_seconds_bucket{op="x",le="+Inf"} 3
+test_seconds_sum{op="x"} 2.55
+test_seconds_count{op="x"} 3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMetricsAndAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	defer func(l *slog.Logger) { accessLog = l }(accessLog)
+	accessLog = slog.New(slog.NewJSONHandler(&logs, nil))
+
+	url, _, _ := startServer(t, defaultConfig(), nil)
+
+	req, e := http.NewRequest(http.MethodGet, url+"/", nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	req.Header.Set(requestIDHeader, "abc123")
+	res, e := http.DefaultClient.Do(req)
+	if e != nil {
+		t.Fatal(e)
+	}
+	res.Body.Close()
+	if got := res.Header.Get(requestIDHeader); got != "abc123" {
+		t.Errorf("request ID header got: %q want: %q", got, "abc123")
+	}
+
+	body := get(t, url+"/metrics")
+	for _, want := range []string{
+		`cardserver_http_requests_total{route="/",method="GET",code="200"}`,
+		`cardserver_http_request_duration_seconds_count{route="/"}`,
+		`carddb_query_duration_seconds_count{op="GetDecks"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %s:\n%s", want, body)
+		}
+	}
+
+	var entry struct {
+		ID         string  `json:"id"`
+		Method     string  `json:"method"`
+		Path       string  `json:"path"`
+		Status     int     `json:"status"`
+		DurationMS float64 `json:"duration_ms"`
+	}
+	line, _, _ := strings.Cut(logs.String(), "\n")
+	if e := json.Unmarshal([]byte(line), &entry); e != nil {
+		t.Fatalf("access log entry %q: %v", line, e)
+	}
+	if entry.ID != "abc123" || entry.Method != "GET" || entry.Path != "/" || entry.Status != 200 {
+		t.Errorf("unexpected access log entry: %+v", entry)
+	}
+}
+
+func TestStudyGradeMetrics(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+	deck, _ := db.NewDeck("Metrics")
+	card, _ := db.NewCard()
+	db.AddCardToDeck(card.ID, deck.ID)
+
+	grades := func(grade string) float64 {
+		studyGrades.mu.Lock()
+		defer studyGrades.mu.Unlock()
+		return studyGrades.values[labelKey([]string{strconv.Itoa(deck.ID), grade})]
+	}
+	before := grades(carddb.GradeGood)
+	get(t, fmt.Sprintf("%s/deck/study/?d=%d", base, deck.ID))
+	get(t, fmt.Sprintf("%s/deck/study/?d=%d&c=%d&dv=-1", base, deck.ID, card.ID))
+	if got := grades(carddb.GradeGood); got != before+1 {
+		t.Errorf("got %v good grades want: %v", got, before+1)
+	}
+	if got := grades(carddb.GradeAgain); got < 1 {
+		t.Errorf("got %v again grades", got)
+	}
+	if body := get(t, base+"/metrics"); strings.Contains(body, `grade="easy"`) {
+		t.Errorf("metrics have an easy grade:\n%s", body)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+func presetHandler(w http.ResponseWriter, r *http.Request) {
+	// List the presets. Posting "name" creates a preset and goes to editing it.
+	if r.Method == http.MethodPost {
+		if e := r.ParseForm(); e != nil {
+			http.Error(w, e.Error(), http.StatusBadRequest)
+			return
+		}
+		preset, e := db.NewPreset(r.PostForm.Get("name"))
+		if e != nil {
+			internalError(w, e)
+			return
+		}
+		http.Redirect(w, r, urlFor(fmt.Sprintf("/preset/edit/?p=%d", preset.ID)), http.StatusFound)
+		return
+	}
+
+	presets, e := db.GetPresets()
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+	if e := executeTemplate(w, "Presets", presets); e != nil {
+		internalError(w, e)
+		return
+	}
+}
+
+func presetEditHandler(w http.ResponseWriter, r *http.Request) {
+	// Edit the preset "p", or delete it if "action" is delete
+	if e := r.ParseForm(); e != nil {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	presetID, _ := strconv.Atoi(r.Form.Get("p"))
+	preset := db.GetPreset(presetID)
+	if preset == nil {
+		log.Printf("No preset with ID %s\n", r.Form.Get("p"))
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if r.PostForm.Get("action") == "delete" {
+			if e := db.DelPreset(preset.ID); e != nil {
+				internalError(w, e)
+				return
+			}
+			http.Redirect(w, r, urlFor("/preset/"), http.StatusFound)
+			return
+		}
+
+		preset.Name = r.PostForm.Get("name")
+		var e error
+		if preset.DateWeight, e = strconv.ParseFloat(r.PostForm.Get("dateWeight"), 64); e != nil {
+			http.Error(w, "Bad date weight", http.StatusBadRequest)
+			return
+		}
+		if preset.ViewWeight, e = strconv.ParseFloat(r.PostForm.Get("viewWeight"), 64); e != nil {
+			http.Error(w, "Bad view weight", http.StatusBadRequest)
+			return
+		}
+		if preset.ViewLimit, e = strconv.Atoi(r.PostForm.Get("viewLimit")); e != nil {
+			http.Error(w, "Bad max views", http.StatusBadRequest)
+			return
+		}
+		if preset.LeechThreshold, e = strconv.Atoi(r.PostForm.Get("leechThreshold")); e != nil {
+			http.Error(w, "Bad leech threshold", http.StatusBadRequest)
+			return
+		}
+		preset.TypeAnswer = r.PostForm.Get("typeAnswer") != ""
+		preset.LeechSuspend = r.PostForm.Get("leechSuspend") != ""
+		if e := db.UpdatePreset(preset); e != nil {
+			internalError(w, e)
+			return
+		}
+		http.Redirect(w, r, urlFor("/preset/"), http.StatusFound)
+		return
+	}
+
+	if e := executeTemplate(w, "EditPreset", preset); e != nil {
+		internalError(w, e)
+		return
+	}
+}
+
+// deckPresetForm is the preset part of the EditDeck form
+type deckPresetForm struct {
+	Presets  []*carddb.Preset
+	PresetID int
+	// Overrides are the carddb.DeckOptions the deck sets itself
+	Overrides map[string]bool
+}
+
+func getDeckPresetForm(deckID int) (*deckPresetForm, error) {
+	f := &deckPresetForm{Overrides: make(map[string]bool)}
+	var e error
+	if f.Presets, e = db.GetPresets(); e != nil {
+		return nil, e
+	}
+	presetID, overrides, e := db.GetDeckPreset(deckID)
+	if e != nil {
+		return nil, e
+	}
+	f.PresetID = presetID
+	for _, option := range overrides {
+		f.Overrides[option] = true
+	}
+	return f, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPresets(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	body := postForm(t, base+"/preset/", url.Values{"name": {"Languages"}})
+	if !strings.Contains(body, `value="Languages"`) {
+		t.Fatalf("got new preset page:\n%s", body)
+	}
+	presets, _ := db.GetPresets()
+	if len(presets) != 1 {
+		t.Fatalf("got presets: %v", presets)
+	}
+	preset := presets[0]
+
+	spanish, _ := db.NewDeck("Spanish")
+	french, _ := db.NewDeck("French")
+	deckForm := func(presetID int, overrides ...string) url.Values {
+		return url.Values{
+			"name": {"Deck"}, "dateWeight": {"1"}, "viewWeight": {"1"}, "viewLimit": {"3"}, "leechThreshold": {"8"},
+			"preset": {fmt.Sprint(presetID)}, "override": overrides,
+		}
+	}
+	postForm(t, fmt.Sprintf("%s/deck/edit/?d=%d", base, spanish.ID), deckForm(preset.ID))
+	postForm(t, fmt.Sprintf("%s/deck/edit/?d=%d", base, french.ID), deckForm(preset.ID, "view_limit"))
+	if body := get(t, fmt.Sprintf("%s/deck/edit/?d=%d", base, french.ID)); !strings.Contains(body,
+		fmt.Sprintf(`<option value="%d" selected>Languages</option>`, preset.ID)) ||
+		!strings.Contains(body, `value="view_limit" checked`) {
+		t.Errorf("got edit deck page:\n%s", body)
+	}
+
+	editURL := fmt.Sprintf("%s/preset/edit/?p=%d", base, preset.ID)
+	body = postForm(t, editURL, url.Values{
+		"name": {"Languages"}, "dateWeight": {"2"}, "viewWeight": {"1"}, "viewLimit": {"5"}, "leechThreshold": {"4"},
+	})
+	if !strings.Contains(body, "Languages</a>\n      (2 decks)") {
+		t.Errorf("got presets page:\n%s", body)
+	}
+	if got := db.GetDeck(spanish.ID); got.DateWeight != 2 || got.ViewLimit != 5 || got.LeechThreshold != 4 {
+		t.Errorf("got linked deck: %+v", got)
+	}
+	if got := db.GetDeck(french.ID); got.DateWeight != 2 || got.ViewLimit != 3 {
+		t.Errorf("got deck with an override: %+v", got)
+	}
+
+	postForm(t, editURL, url.Values{"action": {"delete"}})
+	if presets, _ := db.GetPresets(); len(presets) != 0 {
+		t.Errorf("got presets after deleting: %v", presets)
+	}
+}
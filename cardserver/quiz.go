@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// quizChoices is the number of answers offered per question when the request doesn't say
+const quizChoices = 4
+
+func deckQuizHandler(w http.ResponseWriter, r *http.Request) {
+	// GET makes a multiple choice quiz from the deck's cards, POST scores it. Quizzes don't
+	// count as views.
+	form, e := parseForm(r)
+	if e != nil || form.Deck == nil {
+		if e != nil {
+			log.Println(e)
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	cards, e := db.GetCards(form.Deck.ID)
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		// Only the deck's cards are scored; ones removed from it or deleted while the quiz
+		// was being taken are skipped
+		inDeck := make(map[int]*carddb.Card, len(cards))
+		for _, c := range cards {
+			inDeck[c.ID] = c
+		}
+		result := &carddb.QuizResult{DeckID: form.Deck.ID}
+		for _, idStr := range r.PostForm["q"] {
+			cardID, e := strconv.Atoi(idStr)
+			if e != nil {
+				http.Error(w, fmt.Sprintf("Bad card ID %q", idStr), http.StatusBadRequest)
+				return
+			}
+			card := inDeck[cardID]
+			if card == nil {
+				continue
+			}
+			chosen := r.PostForm.Get(fmt.Sprintf("a%d", cardID))
+			result.Answers = append(result.Answers, carddb.QuizAnswer{
+				CardID:  card.ID,
+				Front:   card.Front,
+				Back:    card.Back,
+				Chosen:  chosen,
+				Correct: chosen == card.Back,
+			})
+		}
+		if e := db.SaveQuizResult(result); e != nil {
+			internalError(w, e)
+			return
+		}
+		http.Redirect(w, r, urlFor(fmt.Sprintf("/quiz/?q=%d", result.ID)), http.StatusFound)
+		return
+	}
+
+	choices := quizChoices
+	if n, e := strconv.Atoi(r.FormValue("n")); e == nil && n > 1 {
+		choices = n
+	}
+	tags, e := db.GetCardTags()
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+	results, e := db.GetQuizResults(form.Deck.ID)
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+
+	if e := executeTemplate(w, "Quiz", struct {
+		Deck      *carddb.Deck
+		Questions []carddb.QuizQuestion
+		Results   []*carddb.QuizResult
+	}{form.Deck, carddb.NewQuiz(cards, tags, choices), results}); e != nil {
+		internalError(w, e)
+		return
+	}
+}
+
+func quizHandler(w http.ResponseWriter, r *http.Request) {
+	// Show the score and per card breakdown of a finished quiz
+	quizID, e := strconv.Atoi(r.FormValue("q"))
+	if e != nil {
+		http.NotFound(w, r)
+		return
+	}
+	result, e := db.GetQuizResult(quizID)
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+	if result == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The deck may have been deleted since
+	if e := executeTemplate(w, "QuizResult", struct {
+		Deck   *carddb.Deck
+		Result *carddb.QuizResult
+	}{db.GetDeck(result.DeckID), result}); e != nil {
+		internalError(w, e)
+		return
+	}
+}
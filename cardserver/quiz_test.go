@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestQuiz(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	deck, e := db.NewDeck("Deck")
+	if e != nil {
+		t.Fatal(e)
+	}
+	backs := []string{"one", "two", "three"}
+	var ids []string
+	for i, back := range backs {
+		card, e := db.NewCard()
+		if e != nil {
+			t.Fatal(e)
+		}
+		card.Front = fmt.Sprintf("front %d", i)
+		card.Back = back
+		if e := db.UpdateCard(card); e != nil {
+			t.Fatal(e)
+		}
+		if e := db.AddCardToDeck(card.ID, deck.ID); e != nil {
+			t.Fatal(e)
+		}
+		ids = append(ids, strconv.Itoa(card.ID))
+	}
+
+	quizURL := fmt.Sprintf("%s/deck/quiz/?d=%d", base, deck.ID)
+	body := get(t, quizURL)
+	for _, back := range backs {
+		if !strings.Contains(body, fmt.Sprintf(`value="%s"`, back)) {
+			t.Errorf("quiz should offer %q:\n%s", back, body)
+		}
+	}
+
+	other, e := db.NewCard()
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// Answer the first right, the second wrong and leave the third. A card from outside the
+	// deck isn't scored.
+	form := url.Values{"q": append(ids, strconv.Itoa(other.ID))}
+	form.Set("a"+strconv.Itoa(other.ID), other.Back)
+	form.Set("a"+ids[0], "one")
+	form.Set("a"+ids[1], "three")
+	res, e := http.PostForm(quizURL, form)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer res.Body.Close()
+	b, e := io.ReadAll(res.Body)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := string(b); !strings.Contains(got, "Score: 1/3") || !strings.Contains(got, "(no answer)") {
+		t.Errorf("result page:\n%s", got)
+	}
+
+	results, e := db.GetQuizResults(deck.ID)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(results) != 1 || results[0].Correct != 1 || results[0].Total != 3 {
+		t.Errorf("got results: %+v", results)
+	}
+	for i, id := range ids {
+		if c, _ := strconv.Atoi(id); db.GetCard(c).Views != 0 {
+			t.Errorf("card %d views changed by quiz", i)
+		}
+	}
+	if body := get(t, quizURL); !strings.Contains(body, "Past Quizzes") {
+		t.Errorf("quiz page should list past results:\n%s", body)
+	}
+}
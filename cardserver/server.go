@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// newHandler returns the handler serving all routes in handlers plus the static files,
+// metrics and health checks, mounted under the configured base path. Requests are logged and counted
+// per route.
+func newHandler() http.Handler {
+	mux := http.NewServeMux()
+	for path, handler := range handlers {
+		mux.Handle(path, instrument(path, handler))
+	}
+
+	staticFS := http.FS(assets)
+	if cfg.Dev {
+		staticFS = http.Dir(cfg.Static)
+	}
+	mux.Handle("/static/", instrument("/static/", http.FileServer(staticFS)))
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler)
+
+	prefix := strings.TrimSuffix(cfg.BasePath, "/")
+	if prefix == "" {
+		return logRequests(mux)
+	}
+	base := http.NewServeMux()
+	base.Handle(prefix+"/", http.StripPrefix(prefix, mux))
+	return logRequests(base)
+}
+
+// newServer creates an http.Server using the timeouts from cfg. If a TLS cert and key
+// are configured the server is set up for HTTPS, reloading them when they change.
+func newServer() (*http.Server, error) {
+	srv := &http.Server{
+		Handler:      newHandler(),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+
+	if cfg.TLSCert != "" {
+		certs, e := newCertReloader(cfg.TLSCert, cfg.TLSKey)
+		if e != nil {
+			return nil, e
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+
+	return srv, nil
+}
+
+// serve runs srv on ln until it fails or ctx is done. When ctx is done in-flight requests
+// are given up to cfg.ShutdownTimeout to finish. The database is closed before returning
+// either way.
+func serve(ctx context.Context, srv *http.Server, ln net.Listener) error {
+	errc := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			errc <- srv.ServeTLS(ln, "", "")
+		} else {
+			errc <- srv.Serve(ln)
+		}
+	}()
+
+	var e error
+	select {
+	case e = <-errc:
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		e = srv.Shutdown(shutdownCtx)
+	}
+
+	if dbErr := db.Close(); e == nil {
+		e = dbErr
+	}
+	return e
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// startServer opens a fresh database and serves it on a random local port using c.
+// Cancelling the returned context shuts the server down; the result of serve is sent on
+// the channel.
+func startServer(t *testing.T, c config, wrap func(http.Handler) http.Handler) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+
+	cfg = c
+	cfg.DB.File = filepath.Join(t.TempDir(), "cards.db")
+
+	var e error
+	db, e = carddb.OpenDatabase(cfg.DB.File)
+	if e != nil {
+		t.Fatal(e)
+	}
+	db.ObserveQuery = observeQuery
+
+	ln, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	srv, e := newServer()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if wrap != nil {
+		srv.Handler = wrap(srv.Handler)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	finished := make(chan struct{})
+	go func() {
+		done <- serve(ctx, srv, ln)
+		close(finished)
+	}()
+	// Wait for the database to be closed so it's not confused with the next test's
+	t.Cleanup(func() {
+		cancel()
+		<-finished
+	})
+
+	return "http://" + ln.Addr().String(), cancel, done
+}
+
+func get(t *testing.T, url string) string {
+	t.Helper()
+	return getStatus(t, url, http.StatusOK)
+}
+
+func getStatus(t *testing.T, url string, status int) string {
+	t.Helper()
+	res, e := http.Get(url)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer res.Body.Close()
+	body, e := io.ReadAll(res.Body)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if res.StatusCode != status {
+		t.Fatalf("GET %s: got status %d want %d", url, res.StatusCode, status)
+	}
+	return string(body)
+}
+
+func TestServeAndShutdown(t *testing.T) {
+	url, stop, done := startServer(t, defaultConfig(), nil)
+
+	if body := get(t, url+"/"); !strings.Contains(body, "New Deck") {
+		t.Errorf("root page missing 'New Deck': %s", body)
+	}
+	if body := get(t, url+"/static/css/common.css"); !strings.Contains(body, ".all") {
+		t.Errorf("unexpected stylesheet: %s", body)
+	}
+
+	stop()
+	select {
+	case e := <-done:
+		if e != nil {
+			t.Fatal(e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+
+	if e := db.Ping(); e == nil {
+		t.Error("database still open after shutdown")
+	}
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	started := make(chan struct{})
+	url, stop, done := startServer(t, defaultConfig(), func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			h.ServeHTTP(w, r)
+		})
+	})
+
+	resc := make(chan *http.Response, 1)
+	errc := make(chan error, 1)
+	go func() {
+		res, e := http.Get(url + "/")
+		resc <- res
+		errc <- e
+	}()
+
+	<-started
+	stop()
+
+	res, e := <-resc, <-errc
+	if e != nil {
+		t.Fatal(e)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("in-flight request got status %d want %d", res.StatusCode, http.StatusOK)
+	}
+	if e := <-done; e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	c := defaultConfig()
+	c.BasePath = "/cards/"
+	url, _, _ := startServer(t, c, nil)
+
+	body := get(t, url+"/cards/")
+	for _, link := range []string{`href="/cards/deck/new"`, `href="/cards/static/css/common.css"`} {
+		if !strings.Contains(body, link) {
+			t.Errorf("root page missing %s: %s", link, body)
+		}
+	}
+	get(t, url+"/cards/static/css/common.css")
+	getStatus(t, url+"/deck/new", http.StatusNotFound)
+
+	deck, e := db.NewDeck("Deck")
+	if e != nil {
+		t.Fatal(e)
+	}
+	card, e := db.NewCard()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := db.AddCardToDeck(card.ID, deck.ID); e != nil {
+		t.Fatal(e)
+	}
+	if body := get(t, fmt.Sprintf("%s/cards/deck/study/?d=%d", url, deck.ID)); !strings.Contains(body, "Card #1") {
+		t.Errorf("study redirect did not stay under the base path: %s", body)
+	}
+}
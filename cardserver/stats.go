@@ -0,0 +1,55 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// statsDays is the number of days covered by the daily charts
+const statsDays = 30
+
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	// Show stats and charts for the given deck, or for all decks if none is given
+	form, e := parseForm(r)
+	if e != nil {
+		log.Println(e)
+		http.NotFound(w, r)
+		return
+	}
+
+	deckID := -1
+	if form.Deck != nil {
+		deckID = form.Deck.ID
+	}
+	stats, e := db.GetStats(deckID, statsDays, cfg.location())
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+
+	if e := executeTemplate(w, "Stats", struct {
+		Deck          *carddb.Deck
+		Stats         *carddb.Stats
+		Days          int
+		ReviewsChart  template.HTML
+		ForecastChart template.HTML
+		MaturityChart template.HTML
+	}{
+		form.Deck,
+		stats,
+		statsDays,
+		barChart(stats.ReviewsPerDay, 7),
+		barChart(stats.DueForecast, 7),
+		stackedChart([]chartPart{
+			{"New", "chart-new", stats.New},
+			{"Young", "chart-young", stats.Young},
+			{"Mature", "chart-mature", stats.Mature},
+		}),
+	}); e != nil {
+		internalError(w, e)
+		return
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+func TestBarChart(t *testing.T) {
+	day := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+	svg := string(barChart([]carddb.DayCount{{Day: day}, {Day: day.AddDate(0, 0, 1), Count: 4}}, 1))
+	if !strings.HasPrefix(svg, "<svg") || strings.Count(svg, "<rect") != 2 ||
+		!strings.Contains(svg, "<title>Jan 2: 4</title>") || !strings.Contains(svg, ">Jan 1</text>") {
+		t.Errorf("got:\n%s", svg)
+	}
+
+	svg = string(stackedChart([]chartPart{{"A", "a", 1}, {"<B>", "b", 3}}))
+	if !strings.Contains(svg, `width="150.0"`) || !strings.Contains(svg, "&lt;B&gt;: 3") {
+		t.Errorf("got:\n%s", svg)
+	}
+}
+
+func TestStatsPage(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	deck, e := db.NewDeck("Deck")
+	if e != nil {
+		t.Fatal(e)
+	}
+	card, e := db.NewCard()
+	if e != nil {
+		t.Fatal(e)
+	}
+	card.Front = "hard one"
+	if e := db.UpdateCard(card); e != nil {
+		t.Fatal(e)
+	}
+	if e := db.AddCardToDeck(card.ID, deck.ID); e != nil {
+		t.Fatal(e)
+	}
+
+	// Studying logs a good review, which the -1 link turns into again
+	get(t, fmt.Sprintf("%s/deck/study/?d=%d", base, deck.ID))
+	get(t, fmt.Sprintf("%s/deck/study/?d=%d&c=%d&dv=-1", base, deck.ID, card.ID))
+	reviews, e := db.GetReviews(card.ID)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(reviews) != 1 || reviews[0].Grade != carddb.GradeAgain {
+		t.Errorf("got reviews: %+v", reviews)
+	}
+
+	for _, u := range []string{base + "/stats/", fmt.Sprintf("%s/stats/?d=%d", base, deck.ID)} {
+		body := get(t, u)
+		if strings.Count(body, "<svg") != 3 || !strings.Contains(body, "Retention: 0%") ||
+			!strings.Contains(body, fmt.Sprintf(`/card/edit/?c=%d">hard one<`, card.ID)) {
+			t.Errorf("%s:\n%s", u, body)
+		}
+	}
+}
+
+func TestHeatmap(t *testing.T) {
+	// A Sunday
+	day := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	var counts []carddb.DayCount
+	for i := 0; i < 10; i++ {
+		counts = append(counts, carddb.DayCount{Day: day.AddDate(0, 0, i), Count: i % 5})
+	}
+	svg := string(heatmap(counts))
+	if strings.Count(svg, "<rect") != 10 || !strings.Contains(svg, ">Jan</text>") {
+		t.Errorf("got:\n%s", svg)
+	}
+	// The empty days, the busiest days and the first day of the second week
+	if strings.Count(svg, `class="heat-0"`) != 2 || strings.Count(svg, `class="heat-4"`) != 2 ||
+		!strings.Contains(svg, `class="heat-2" x="33" y="20"`) {
+		t.Errorf("got:\n%s", svg)
+	}
+}
+
+func TestRootStreak(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	deck, e := db.NewDeck("Deck")
+	if e != nil {
+		t.Fatal(e)
+	}
+	card, e := db.NewCard()
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, days := range []int{0, 1} {
+		r := &carddb.Review{CardID: card.ID, DeckID: deck.ID, Grade: carddb.GradeGood, Time: time.Now().AddDate(0, 0, -days)}
+		if e := db.AddReview(r); e != nil {
+			t.Fatal(e)
+		}
+	}
+	body := get(t, base+"/")
+	if !strings.Contains(body, "Streak: 2 days (longest 2)") || !strings.Contains(body, `class="heatmap"`) {
+		t.Errorf("got:\n%s", body)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+func TestTypedAnswer(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	deck, e := db.NewDeck("Deck")
+	if e != nil {
+		t.Fatal(e)
+	}
+	deck.TypeAnswer = true
+	if e := db.UpdateDeck(deck); e != nil {
+		t.Fatal(e)
+	}
+	card, e := db.NewCard()
+	if e != nil {
+		t.Fatal(e)
+	}
+	card.Back = "Crème brûlée"
+	card.Views = 3
+	if e := db.UpdateCard(card); e != nil {
+		t.Fatal(e)
+	}
+	if e := db.AddCardToDeck(card.ID, deck.ID); e != nil {
+		t.Fatal(e)
+	}
+
+	studyURL := fmt.Sprintf("%s/deck/study/?d=%d&c=%d", base, deck.ID, card.ID)
+	if body := get(t, studyURL); !strings.Contains(body, `name="answer"`) || strings.Contains(body, "brûlée") {
+		t.Errorf("study page should ask for the answer without showing it:\n%s", body)
+	}
+
+	post := func(answer string) string {
+		t.Helper()
+		res, e := http.PostForm(studyURL, url.Values{"answer": {answer}})
+		if e != nil {
+			t.Fatal(e)
+		}
+		defer res.Body.Close()
+		body, e := io.ReadAll(res.Body)
+		if e != nil {
+			t.Fatal(e)
+		}
+		return string(body)
+	}
+	if body := post("creme brulee"); !strings.Contains(body, "<h3>Correct</h3>") {
+		t.Errorf("expected a correct answer:\n%s", body)
+	}
+	if body := post("custard"); !strings.Contains(body, "<h3>Incorrect</h3>") || !strings.Contains(body, "diff-missing") {
+		t.Errorf("expected an incorrect answer with a diff:\n%s", body)
+	}
+
+	reviews, e := db.GetReviews(card.ID)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(reviews) != 2 || reviews[0].Grade != carddb.GradeIncorrect || reviews[1].Grade != carddb.GradeCorrect ||
+		reviews[0].Answer != "custard" || reviews[0].DeckID != deck.ID {
+		t.Errorf("got reviews: %+v %+v", reviews[0], reviews[1])
+	}
+	if got := db.GetCard(card.ID).Views; got != 2 {
+		t.Errorf("views after an incorrect answer got: %d want: 2", got)
+	}
+
+	// The result is a page of its own, so loading it again doesn't grade the card again
+	res, e := http.PostForm(studyURL, url.Values{"answer": {"flan"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	res.Body.Close()
+	resultURL := res.Request.URL.String()
+	for i := 0; i < 2; i++ {
+		if body := get(t, resultURL); !strings.Contains(body, "<h3>Incorrect</h3>") || !strings.Contains(body, "flan") {
+			t.Errorf("result page:\n%s", body)
+		}
+	}
+	if reviews, _ := db.GetReviews(card.ID); len(reviews) != 3 {
+		t.Errorf("got %d reviews after reloading the result", len(reviews))
+	}
+	if got := db.GetCard(card.ID).Views; got != 1 {
+		t.Errorf("views after reloading the result got: %d want: 1", got)
+	}
+}
+
+func TestLeechAndSuspend(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	deck, e := db.NewDeck("Deck")
+	if e != nil {
+		t.Fatal(e)
+	}
+	deck.TypeAnswer = true
+	deck.LeechThreshold = 2
+	deck.LeechSuspend = true
+	if e := db.UpdateDeck(deck); e != nil {
+		t.Fatal(e)
+	}
+	var cards []*carddb.Card
+	for i := 0; i < 2; i++ {
+		card, e := db.NewCard()
+		if e != nil {
+			t.Fatal(e)
+		}
+		card.Back = "answer"
+		if e := db.UpdateCard(card); e != nil {
+			t.Fatal(e)
+		}
+		if e := db.AddCardToDeck(card.ID, deck.ID); e != nil {
+			t.Fatal(e)
+		}
+		cards = append(cards, card)
+	}
+
+	studyURL := fmt.Sprintf("%s/deck/study/?d=%d&c=%d", base, deck.ID, cards[0].ID)
+	for i := 0; i < 2; i++ {
+		res, e := http.PostForm(studyURL, url.Values{"answer": {"wrong"}})
+		if e != nil {
+			t.Fatal(e)
+		}
+		res.Body.Close()
+	}
+	if got := db.GetCard(cards[0].ID); !got.Leech || !got.Suspended {
+		t.Errorf("card failed twice: %+v", got)
+	}
+
+	// Only the other card is picked for study, but both are listed
+	for i := 0; i < 5; i++ {
+		res, e := http.Get(fmt.Sprintf("%s/deck/study/?d=%d", base, deck.ID))
+		if e != nil {
+			t.Fatal(e)
+		}
+		res.Body.Close()
+		if want := fmt.Sprintf("c=%d", cards[1].ID); !strings.Contains(res.Request.URL.RawQuery, want) {
+			t.Errorf("studied %s want %s", res.Request.URL.RawQuery, want)
+		}
+	}
+	body := get(t, fmt.Sprintf("%s/deck/?d=%d", base, deck.ID))
+	if strings.Count(body, `name="cards"`) != 2 || !strings.Contains(body, "leech</span>") {
+		t.Errorf("deck page:\n%s", body)
+	}
+
+	suspendURL := base + "/card/bulk/"
+	res, e := http.PostForm(suspendURL, url.Values{
+		"from":   {strconv.Itoa(deck.ID)},
+		"action": {"unsuspend"},
+		"cards":  {strconv.Itoa(cards[0].ID)},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	res.Body.Close()
+	if got := db.GetCard(cards[0].ID); got.Leech || got.Suspended {
+		t.Errorf("unsuspended card: %+v", got)
+	}
+
+	res, e = http.PostForm(suspendURL, url.Values{
+		"from":   {strconv.Itoa(deck.ID)},
+		"action": {"suspend"},
+		"cards":  {strconv.Itoa(cards[0].ID), strconv.Itoa(cards[1].ID)},
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	res.Body.Close()
+	for _, c := range cards {
+		if !db.GetCard(c.ID).Suspended {
+			t.Errorf("card %d not suspended", c.ID)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Bredgren/cards/carddb"
+)
+
+// trashPurgeInterval is how often items older than the trash retention are purged
+const trashPurgeInterval = time.Hour
+
+func trashHandler(w http.ResponseWriter, r *http.Request) {
+	// List the trash. Posting a deck or card ID with action "restore" or "purge" acts on
+	// it, and action "empty" purges everything.
+	if r.Method == http.MethodPost {
+		if e := r.ParseForm(); e != nil {
+			http.Error(w, e.Error(), http.StatusBadRequest)
+			return
+		}
+		if e := trashAction(r.PostForm.Get("action"), r.PostForm.Get("deck"), r.PostForm.Get("card")); e != nil {
+			http.Error(w, e.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, urlFor("/trash/"), http.StatusFound)
+		return
+	}
+
+	decks, cards, e := db.GetTrash()
+	if e != nil {
+		internalError(w, e)
+		return
+	}
+	if e := executeTemplate(w, "Trash", struct {
+		Decks     []*carddb.TrashedDeck
+		Cards     []*carddb.TrashedCard
+		Retention string
+	}{decks, cards, retentionText(cfg.TrashRetention)}); e != nil {
+		internalError(w, e)
+		return
+	}
+}
+
+// retentionText describes the retention in days when it's a whole number of them
+func retentionText(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	const day = 24 * time.Hour
+	if d%day == 0 {
+		if d == day {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", d/day)
+	}
+	return d.String()
+}
+
+// trashAction restores or purges the deck or card with the given ID, whichever is set
+func trashAction(action, deckID, cardID string) error {
+	if action == "empty" {
+		_, _, e := db.PurgeTrash(time.Now())
+		return e
+	}
+
+	isDeck := deckID != ""
+	idStr := cardID
+	if isDeck {
+		idStr = deckID
+	}
+	id, e := strconv.Atoi(idStr)
+	if e != nil {
+		return fmt.Errorf("Bad ID %q", idStr)
+	}
+
+	switch {
+	case action == "restore" && isDeck:
+		return db.RestoreDeck(id)
+	case action == "restore":
+		return db.RestoreCard(id)
+	case action == "purge" && isDeck:
+		return db.PurgeDeck(id)
+	case action == "purge":
+		return db.PurgeCard(id)
+	}
+	return fmt.Errorf("Unknown action %q", action)
+}
+
+// purgeTrash permanently deletes what has been in the trash longer than the configured
+// retention, then again every interval until ctx is done. A retention of 0 keeps the trash
+// forever.
+func purgeTrash(ctx context.Context, interval time.Duration) {
+	if cfg.TrashRetention == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		decks, cards, e := db.PurgeTrash(time.Now().Add(-cfg.TrashRetention))
+		if e != nil {
+			log.Println("Purging trash:", e)
+		} else if decks+cards > 0 {
+			log.Printf("Purged %d decks and %d cards from the trash", decks, cards)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
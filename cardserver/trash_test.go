@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	base, _, _ := startServer(t, defaultConfig(), nil)
+
+	deck, _ := db.NewDeck("Trashed Deck")
+	card, _ := db.NewCard()
+	card.Front = "trashed card"
+	db.UpdateCard(card)
+	db.AddCardToDeck(card.ID, deck.ID)
+
+	post := func(path string, values url.Values) {
+		t.Helper()
+		res, e := http.PostForm(base+path, values)
+		if e != nil {
+			t.Fatal(e)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("POST %s %v: %s", path, values, res.Status)
+		}
+	}
+
+	post(fmt.Sprintf("/card/delete/?c=%d", card.ID), nil)
+	post(fmt.Sprintf("/deck/delete/?d=%d", deck.ID), nil)
+	if body := get(t, base+"/"); strings.Contains(body, "Trashed Deck") {
+		t.Errorf("trashed deck on the home page:\n%s", body)
+	}
+	body := get(t, base+"/trash/")
+	for _, want := range []string{"Trashed Deck", "trashed card", "30 days"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("trash page missing %q:\n%s", want, body)
+		}
+	}
+
+	post("/trash/", url.Values{"action": {"restore"}, "deck": {fmt.Sprint(deck.ID)}})
+	post("/trash/", url.Values{"action": {"restore"}, "card": {fmt.Sprint(card.ID)}})
+	if cards, _ := db.GetCards(deck.ID); len(cards) != 1 || cards[0].ID != card.ID {
+		t.Errorf("got restored deck's cards: %v", cards)
+	}
+
+	db.DelCard(card.ID)
+	post("/trash/", url.Values{"action": {"purge"}, "card": {fmt.Sprint(card.ID)}})
+	if decks, cards, _ := db.GetTrash(); len(decks) != 0 || len(cards) != 0 {
+		t.Errorf("got trash: %v %v", decks, cards)
+	}
+
+	res, e := http.PostForm(base+"/trash/", url.Values{"action": {"restore"}, "card": {fmt.Sprint(card.ID)}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("restoring a purged card got: %s", res.Status)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	startServer(t, defaultConfig(), nil)
+	cfg.TrashRetention = time.Minute
+
+	old, _ := db.NewCard()
+	recent, _ := db.NewCard()
+	db.DelCard(old.ID)
+	db.DelCard(recent.ID)
+	db.Exec(`UPDATE card SET deleted=? WHERE card_id=?`, time.Now().Add(-time.Hour).UTC(), old.ID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	purgeTrash(ctx, time.Hour)
+
+	if _, cards, _ := db.GetTrash(); len(cards) != 1 || cards[0].ID != recent.ID {
+		t.Errorf("got trashed cards: %v", cards)
+	}
+}